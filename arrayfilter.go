@@ -0,0 +1,341 @@
+package gopiper
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// arrayValue 返回切片的 reflect.Value。src 不是切片时 ok 为 false
+func arrayValue(src interface{}) (reflect.Value, bool) {
+	if src == nil {
+		return reflect.Value{}, false
+	}
+	rv := reflect.ValueOf(src)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 { // []byte 视为字符串
+		return rv, false
+	}
+	return rv, true
+}
+
+// copyArray 复制切片(不修改原切片)
+func copyArray(rv reflect.Value) reflect.Value {
+	cp := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+	reflect.Copy(cp, rv)
+	return cp
+}
+
+// toInterfaceSlice 将各种类型的切片转为 []interface{}
+func toInterfaceSlice(src interface{}) ([]interface{}, bool) {
+	if vt, ok := src.([]interface{}); ok {
+		return vt, true
+	}
+	rv, ok := arrayValue(src)
+	if !ok {
+		return nil, false
+	}
+	res := make([]interface{}, rv.Len())
+	for i := range res {
+		res[i] = rv.Index(i).Interface()
+	}
+	return res, true
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch vt := v.(type) {
+	case nil:
+		return true
+	case string:
+		return len(strings.TrimSpace(vt)) == 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// valueKey 用于比较元素是否相同
+func valueKey(v interface{}) string {
+	return fmt.Sprintf("%T:%v", v, v)
+}
+
+// valueNumber 将元素转为数值，不是数值时 ok 为 false
+func valueNumber(v interface{}) (float64, bool) {
+	switch vt := v.(type) {
+	case int:
+		return float64(vt), true
+	case int8:
+		return float64(vt), true
+	case int16:
+		return float64(vt), true
+	case int32:
+		return float64(vt), true
+	case int64:
+		return float64(vt), true
+	case uint:
+		return float64(vt), true
+	case uint8:
+		return float64(vt), true
+	case uint16:
+		return float64(vt), true
+	case uint32:
+		return float64(vt), true
+	case uint64:
+		return float64(vt), true
+	case float32:
+		return float64(vt), true
+	case float64:
+		return vt, true
+	case fmt.Stringer: // 例如 json.Number
+		n, err := ParseNumber(vt.String(), ``)
+		return n, err == nil
+	case string:
+		n, err := ParseNumber(vt, ``)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// unique => src=["a","b","a"] => ["a","b"]
+func unique(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	rv, ok := arrayValue(src)
+	if !ok {
+		return src, nil
+	}
+	res := reflect.MakeSlice(rv.Type(), 0, rv.Len())
+	seen := map[string]struct{}{}
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		key := valueKey(item.Interface())
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		res = reflect.Append(res, item)
+	}
+	return res.Interface(), nil
+}
+
+// sort(desc) => src=["b","a","c"] => ["c","b","a"]
+// sort(numeric) => src=["10","9","100"] => ["9","10","100"]
+func sortArray(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	rv, ok := arrayValue(src)
+	if !ok {
+		return src, nil
+	}
+	var desc, numeric bool
+	for _, param := range SplitParams(params) {
+		switch strings.ToLower(strings.TrimSpace(param)) {
+		case `desc`:
+			desc = true
+		case `numeric`:
+			numeric = true
+		case `asc`, ``:
+		default:
+			return src, fmt.Errorf("Filter sort unsupported param: %s", param)
+		}
+	}
+	res := copyArray(rv)
+	keys := make([]interface{}, res.Len())
+	for i := range keys {
+		keys[i] = res.Index(i).Interface()
+	}
+	less := func(a, b interface{}) bool {
+		_, isStringA := a.(string)
+		_, isStringB := b.(string)
+		if numeric || !(isStringA || isStringB) {
+			na, oka := valueNumber(a)
+			nb, okb := valueNumber(b)
+			if oka && okb {
+				return na < nb
+			}
+			if numeric && oka != okb { // 不是数值的元素排在最后
+				return oka
+			}
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	}
+	swap := reflect.Swapper(res.Interface())
+	sort.Stable(&arraySorter{keys: keys, swap: swap, less: func(a, b interface{}) bool {
+		if desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	}})
+	return res.Interface(), nil
+}
+
+type arraySorter struct {
+	keys []interface{}
+	swap func(i, j int)
+	less func(a, b interface{}) bool
+}
+
+func (s *arraySorter) Len() int           { return len(s.keys) }
+func (s *arraySorter) Less(i, j int) bool { return s.less(s.keys[i], s.keys[j]) }
+func (s *arraySorter) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.swap(i, j)
+}
+
+// arrayIndex 将负数编号转为从头开始的编号，并限制在 [0,length] 范围内
+func arrayIndex(index int, length int) int {
+	if index < 0 {
+		index += length
+	}
+	if index < 0 {
+		return 0
+	}
+	if index > length {
+		return length
+	}
+	return index
+}
+
+// slice(1,3) => src=["a","b","c","d"] => ["b","c"]
+// slice(-2) => src=["a","b","c","d"] => ["c","d"]
+func slice(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	rv, ok := arrayValue(src)
+	if !ok {
+		return src, nil
+	}
+	length := rv.Len()
+	start, end := 0, length
+	args := SplitParams(params)
+	var err error
+	switch len(args) {
+	case 2:
+		if v := strings.TrimSpace(args[1]); len(v) > 0 {
+			if end, err = strconv.Atoi(v); err != nil {
+				return src, err
+			}
+			end = arrayIndex(end, length)
+		}
+		fallthrough
+	case 1:
+		if v := strings.TrimSpace(args[0]); len(v) > 0 {
+			if start, err = strconv.Atoi(v); err != nil {
+				return src, err
+			}
+			start = arrayIndex(start, length)
+		}
+	}
+	if start > end {
+		start = end
+	}
+	return copyArray(rv.Slice(start, end)).Interface(), nil
+}
+
+// compact => src=["a","","b",null] => ["a","b"]
+func compact(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	rv, ok := arrayValue(src)
+	if !ok {
+		return src, nil
+	}
+	res := reflect.MakeSlice(rv.Type(), 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		if isEmptyValue(rv.Index(i).Interface()) {
+			continue
+		}
+		res = reflect.Append(res, rv.Index(i))
+	}
+	return res.Interface(), nil
+}
+
+// flatten => src=[["a","b"],["c"]] => ["a","b","c"]
+func flatten(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	items, ok := toInterfaceSlice(src)
+	if !ok {
+		return src, nil
+	}
+	res := make([]interface{}, 0, len(items))
+	var walk func([]interface{})
+	walk = func(items []interface{}) {
+		for _, item := range items {
+			if sub, ok := toInterfaceSlice(item); ok {
+				walk(sub)
+				continue
+			}
+			res = append(res, item)
+		}
+	}
+	walk(items)
+	return res, nil
+}
+
+// first => src=["a","b"] => "a"
+func first(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	rv, ok := arrayValue(src)
+	if !ok {
+		return src, nil
+	}
+	if rv.Len() == 0 {
+		return nil, nil
+	}
+	return rv.Index(0).Interface(), nil
+}
+
+// last => src=["a","b"] => "b"
+func last(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	rv, ok := arrayValue(src)
+	if !ok {
+		return src, nil
+	}
+	if rv.Len() == 0 {
+		return nil, nil
+	}
+	return rv.Index(rv.Len() - 1).Interface(), nil
+}
+
+// count => src=["a","b"] => 2
+func count(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	if src == nil {
+		return 0, nil
+	}
+	rv := reflect.ValueOf(src)
+	if _, ok := arrayValue(src); ok || rv.Kind() == reflect.Map {
+		return rv.Len(), nil
+	}
+	return 1, nil
+}
+
+// reverse => src=["a","b","c"] => ["c","b","a"]
+func reverse(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	rv, ok := arrayValue(src)
+	if !ok {
+		return src, nil
+	}
+	res := copyArray(rv)
+	swap := reflect.Swapper(res.Interface())
+	for i, j := 0, res.Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+	return res.Interface(), nil
+}
+
+// chunk(2) => src=["a","b","c"] => [["a","b"],["c"]]
+func chunk(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	rv, ok := arrayValue(src)
+	if !ok {
+		return src, nil
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(params))
+	if err != nil || size <= 0 {
+		return src, fmt.Errorf("Filter chunk invalid size: %s", params)
+	}
+	res := make([]interface{}, 0, (rv.Len()+size-1)/size)
+	for i := 0; i < rv.Len(); i += size {
+		end := i + size
+		if end > rv.Len() {
+			end = rv.Len()
+		}
+		res = append(res, copyArray(rv.Slice(i, end)).Interface())
+	}
+	return res, nil
+}
@@ -0,0 +1,59 @@
+package gopiper
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache 并发安全的LRU缓存，超出容量时删除最久未使用的项
+type lruCache struct {
+	mu    sync.Mutex
+	ll    *list.List
+	items map[interface{}]*list.Element
+}
+
+type lruEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+func newLRUCache() *lruCache {
+	return &lruCache{ll: list.New(), items: map[interface{}]*list.Element{}}
+}
+
+func (c *lruCache) get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+// add 添加缓存项。max 为容量上限，小于等于0时不缓存
+func (c *lruCache) add(key interface{}, value interface{}, max int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*lruEntry).value = value
+		return
+	}
+	if max <= 0 {
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value})
+	for c.ll.Len() > max {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
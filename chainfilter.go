@@ -0,0 +1,419 @@
+package gopiper
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// chainFilters 参数为过滤器链的过滤器。这些过滤器的参数按括号配对解析，
+// 以便支持 each(substr(0,2)|trim) 这样的写法
+var chainFilters = map[string]bool{
+	`each`:     true,
+	`if`:       true,
+	`switch`:   true,
+	`coalesce`: true,
+	`expr`:     true,
+	`js`:       true,
+}
+
+type filterCall struct {
+	name   string
+	params string
+}
+
+// parseFilters 解析过滤器字符串。例如：trimspace|substr(0,5)|each(trimspace|substr(0,2))
+func parseFilters(value string) []filterCall {
+	var calls []filterCall
+	for len(value) > 0 {
+		loc := filterExp.FindStringSubmatchIndex(value)
+		if loc == nil {
+			break
+		}
+		call := filterCall{name: value[loc[2]:loc[3]]}
+		end := loc[1]
+		if loc[4] >= 0 {
+			call.params = value[loc[4]:loc[5]]
+			if chainFilters[call.name] {
+				if params, pos, ok := balancedParams(value, loc[4]-1); ok {
+					call.params, end = params, pos
+				}
+			}
+		}
+		calls = append(calls, call)
+		value = value[end:]
+	}
+	return calls
+}
+
+// balancedParams 从 value[open] 处的左括号开始查找与其配对的右括号(其后须为“|”或结尾)，返回括号中的参数和结束位置
+func balancedParams(value string, open int) (string, int, bool) {
+	depth := 0
+	for i := open; i < len(value); i++ {
+		switch value[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth != 0 {
+				continue
+			}
+			end := i + 1
+			if end < len(value) {
+				if value[end] != '|' {
+					return ``, 0, false
+				}
+				end++
+			}
+			return value[open+1 : i], end, true
+		}
+	}
+	return ``, 0, false
+}
+
+// runFilters 依次执行过滤器。nested 为 true 时不在 trace 中记录(用于 each 等过滤器中的子过滤器链)
+func runFilters(pipe *PipeItem, src interface{}, value string, nested bool) (interface{}, error) {
+	for _, call := range parseFilters(value) {
+		var err error
+		params := pipe.resolveParams(call.name, call.params)
+		src, err = pipe.beforeFilter(call.name, params, src)
+		if err != nil {
+			return src, err
+		}
+		start := time.Now()
+		next, err := applyFilter(pipe, call.name, src, params)
+		next, err = pipe.afterFilter(call.name, params, next, err)
+		if !nested {
+			pipe.node.addFilter(call.name, params, next, err, time.Since(start))
+		}
+		if err != nil {
+			if err == ErrInvalidContent || isFatalFilterError(err) {
+				return next, err
+			}
+			continue
+		}
+		src = next
+	}
+	return src, nil
+}
+
+// each(trimspace|substr(0,5)) => src=[" abcdef "," ghijkl "] => ["abcde","ghijk"]
+// 值为map时对map中的每个值执行
+func each(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	if m, ok := toMap(src); ok {
+		res := make(map[string]interface{}, len(m))
+		for k, item := range m {
+			v, err := runFilters(pipe, item, params, true)
+			if err != nil {
+				return src, err
+			}
+			res[k] = v
+		}
+		return res, nil
+	}
+	items, ok := toInterfaceSlice(src)
+	if !ok {
+		return runFilters(pipe, src, params, true)
+	}
+	res := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		v, err := runFilters(pipe, item, params, true)
+		if err != nil {
+			return src, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+var conditionOpExp = regexp.MustCompile(`^(?:==|!=|>=|<=|>|<|=|!~|~|(?:contains|startswith|endswith|in|exists|empty)(?:\s|$))`)
+
+var conditionExp = regexp.MustCompile(`^\s*(\S+?)\s*(==|!=|>=|<=|>|<|=|!~|~|\s(?:contains|startswith|endswith|in|exists|empty)(?:\s|$))\s*(.*?)\s*$`)
+
+// condition where/reject 的条件
+type condition struct {
+	field string
+	op    string
+	value interface{}
+	re    *regexp.Regexp
+}
+
+// parseCondition 解析条件。例如：price > 100、status == on、title ~ ^abc、tags contains a、name exists、name。
+// 省略字段时代表值本身，例如：contains free 等同于 . contains free
+func parseCondition(params string) (*condition, error) {
+	params = strings.TrimSpace(params)
+	if len(params) == 0 {
+		return nil, errors.New("Condition is empty")
+	}
+	if conditionOpExp.MatchString(params) {
+		params = `. ` + params
+	}
+	m := conditionExp.FindStringSubmatch(params)
+	if m == nil {
+		if strings.ContainsAny(params, " \t") {
+			return nil, fmt.Errorf("Invalid condition: %s", params)
+		}
+		return &condition{field: params, op: `truthy`}, nil
+	}
+	c := &condition{field: m[1], op: strings.TrimSpace(m[2])}
+	switch c.op {
+	case `=`:
+		c.op = `==`
+	case `~`, `!~`:
+		re, err := regexp.Compile(m[3])
+		if err != nil {
+			return nil, err
+		}
+		c.re = re
+	case `exists`, `empty`:
+		if len(m[3]) > 0 {
+			return nil, fmt.Errorf("Invalid condition: %s", params)
+		}
+	}
+	c.value = parseParamValue(m[3])
+	return c, nil
+}
+
+// conditionField 获取元素中用于比较的值。field 为“.”时使用元素本身
+func conditionField(item interface{}, field string) (interface{}, bool) {
+	if field == `.` {
+		return item, true
+	}
+	return GetPath(item, field)
+}
+
+func isTruthy(v interface{}) bool {
+	switch vt := v.(type) {
+	case bool:
+		return vt
+	case string:
+		vt = strings.TrimSpace(vt)
+		return len(vt) > 0 && vt != `0` && strings.ToLower(vt) != `false`
+	}
+	if n, ok := valueNumber(v); ok {
+		return n != 0
+	}
+	return !isEmptyValue(v)
+}
+
+// compareValues 比较两个值：都是数值时按数值比较，否则按字符串比较
+func compareValues(a, b interface{}) int {
+	na, oka := valueNumber(a)
+	nb, okb := valueNumber(b)
+	if oka && okb {
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func (c *condition) match(item interface{}) bool {
+	v, exists := conditionField(item, c.field)
+	switch c.op {
+	case `truthy`:
+		return exists && isTruthy(v)
+	case `exists`:
+		return exists
+	case `empty`:
+		return !exists || isEmptyValue(v)
+	}
+	if !exists {
+		return c.op == `!=` || c.op == `!~`
+	}
+	switch c.op {
+	case `==`:
+		return compareValues(v, c.value) == 0
+	case `!=`:
+		return compareValues(v, c.value) != 0
+	case `>`:
+		return compareValues(v, c.value) > 0
+	case `>=`:
+		return compareValues(v, c.value) >= 0
+	case `<`:
+		return compareValues(v, c.value) < 0
+	case `<=`:
+		return compareValues(v, c.value) <= 0
+	case `~`:
+		return c.re.MatchString(fmt.Sprint(v))
+	case `!~`:
+		return !c.re.MatchString(fmt.Sprint(v))
+	case `contains`:
+		if items, ok := toInterfaceSlice(v); ok {
+			for _, item := range items {
+				if compareValues(item, c.value) == 0 {
+					return true
+				}
+			}
+			return false
+		}
+		return strings.Contains(fmt.Sprint(v), fmt.Sprint(c.value))
+	case `startswith`:
+		return strings.HasPrefix(fmt.Sprint(v), fmt.Sprint(c.value))
+	case `endswith`:
+		return strings.HasSuffix(fmt.Sprint(v), fmt.Sprint(c.value))
+	case `in`:
+		candidates, ok := toInterfaceSlice(c.value)
+		if !ok {
+			for _, s := range strings.Split(fmt.Sprint(c.value), `,`) {
+				candidates = append(candidates, strings.TrimSpace(s))
+			}
+		}
+		for _, candidate := range candidates {
+			if compareValues(v, candidate) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func filterByCondition(src interface{}, params string, keep bool) (interface{}, error) {
+	items, ok := toInterfaceSlice(src)
+	if !ok {
+		return src, nil
+	}
+	c, err := parseCondition(params)
+	if err != nil {
+		return src, err
+	}
+	res := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if c.match(item) == keep {
+			res = append(res, item)
+		}
+	}
+	return res, nil
+}
+
+// where(price > 100) => src=[{"price":50},{"price":150}] => [{"price":150}]
+func where(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return filterByCondition(src, params, true)
+}
+
+// reject(price > 100) => src=[{"price":50},{"price":150}] => [{"price":50}]
+func reject(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return filterByCondition(src, params, false)
+}
+
+// groupby(type) => src=[{"type":"a","v":1},{"type":"b","v":2}] => {"a":[{"type":"a","v":1}],"b":[{"type":"b","v":2}]}
+func groupby(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	items, ok := toInterfaceSlice(src)
+	if !ok {
+		return src, nil
+	}
+	field := strings.TrimSpace(params)
+	if len(field) == 0 {
+		field = `.`
+	}
+	res := map[string]interface{}{}
+	for _, item := range items {
+		v, _ := conditionField(item, field)
+		key := ``
+		if v != nil {
+			key = fmt.Sprint(v)
+		}
+		group, _ := res[key].([]interface{})
+		res[key] = append(group, item)
+	}
+	return res, nil
+}
+
+// aggregateNumbers 获取数组元素(或元素中 field 字段)的数值，忽略不是数值的元素
+func aggregateNumbers(src interface{}, field string) ([]float64, bool) {
+	items, ok := toInterfaceSlice(src)
+	if !ok {
+		return nil, false
+	}
+	field = strings.TrimSpace(field)
+	if len(field) == 0 {
+		field = `.`
+	}
+	numbers := make([]float64, 0, len(items))
+	for _, item := range items {
+		v, exists := conditionField(item, field)
+		if !exists {
+			continue
+		}
+		if n, ok := valueNumber(v); ok {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, true
+}
+
+// numberResult 整数返回 int64，否则返回 float64
+func numberResult(n float64) interface{} {
+	if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+		return int64(n)
+	}
+	return n
+}
+
+// sum(price) => src=[{"price":1},{"price":2}] => 3
+func aggSum(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	numbers, ok := aggregateNumbers(src, params)
+	if !ok {
+		return src, nil
+	}
+	var total float64
+	for _, n := range numbers {
+		total += n
+	}
+	return numberResult(total), nil
+}
+
+// min(price) => src=[{"price":1},{"price":2}] => 1
+func aggMin(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	numbers, ok := aggregateNumbers(src, params)
+	if !ok {
+		return src, nil
+	}
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+	res := numbers[0]
+	for _, n := range numbers[1:] {
+		res = math.Min(res, n)
+	}
+	return numberResult(res), nil
+}
+
+// max(price) => src=[{"price":1},{"price":2}] => 2
+func aggMax(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	numbers, ok := aggregateNumbers(src, params)
+	if !ok {
+		return src, nil
+	}
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+	res := numbers[0]
+	for _, n := range numbers[1:] {
+		res = math.Max(res, n)
+	}
+	return numberResult(res), nil
+}
+
+// avg(price) => src=[{"price":1},{"price":2}] => 1.5
+func aggAvg(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	numbers, ok := aggregateNumbers(src, params)
+	if !ok {
+		return src, nil
+	}
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+	var total float64
+	for _, n := range numbers {
+		total += n
+	}
+	return total / float64(len(numbers)), nil
+}
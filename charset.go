@@ -0,0 +1,199 @@
+package gopiper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// CharsetAuto 自动识别页面编码
+const CharsetAuto = `auto`
+
+// DefaultCharset PipeBytes 默认使用的页面编码。为空时不转换，为 auto 时自动识别
+var DefaultCharset = ``
+
+// charsetPrescanSize 查找 <meta charset> 和 XML 声明的范围(字节)
+const charsetPrescanSize = 4096
+
+var (
+	metaCharsetExp = regexp.MustCompile(`(?i)<meta\s[^>]*charset\s*=\s*["']?\s*([\w\-:.]+)`)
+	xmlEncodingExp = regexp.MustCompile(`(?i)^\s*<\?xml\s[^>]*encoding\s*=\s*["']([\w\-:.]+)["']`)
+
+	// guessCharsets 无法确定编码时依次尝试的编码
+	guessCharsets = []string{`gb18030`, `big5`}
+	// commonHanzi 常用汉字(简体和繁体)，用于判断哪种编码解码后的文字更合理
+	commonHanzi = `的一是不了在人有我他这這个個们們中来來上大为為和国國地到以说說时時要就出会會可也你对對生能而子那得于於着著下自之年过過发發后後作里裡用道行所然家种種事成方多经經么麼去法学學如都同现現当當没沒动動面起看定天分还還进進好小部其些主样樣理心她本前开開但因只从從想实實日新闻聞网網页頁首`
+)
+
+// GetEncoding 根据编码名称获取编码。支持 WHATWG 编码标准中的名称及别名，例如 gbk、gb2312、gb18030、big5、shift_jis、euc-kr、latin1
+func GetEncoding(charset string) (encoding.Encoding, error) {
+	e, err := htmlindex.Get(strings.TrimSpace(charset))
+	if err != nil {
+		return nil, fmt.Errorf("Unsupported charset %q: %w", charset, err)
+	}
+	return e, nil
+}
+
+// iconvEncoding 获取 iconv 使用的编码。与 GetEncoding 不同，latin1 使用真正的 ISO-8859-1(而不是 windows-1252)，
+// 每个字节都对应一个字符，以便还原被当作 latin1 解码的内容
+func iconvEncoding(charset string) (encoding.Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case `latin1`, `latin-1`, `l1`, `iso-8859-1`, `iso8859-1`, `iso_8859-1`, `iso88591`:
+		return charmap.ISO8859_1, nil
+	}
+	return GetEncoding(charset)
+}
+
+func charsetName(e encoding.Encoding) string {
+	name, _ := htmlindex.Name(e)
+	return name
+}
+
+// declaredCharset 返回 XML 声明或 <meta> 标签中声明的编码
+func declaredCharset(body []byte, pageType string) string {
+	head := body
+	if len(head) > charsetPrescanSize {
+		head = head[:charsetPrescanSize]
+	}
+	if m := xmlEncodingExp.FindSubmatch(head); m != nil {
+		return string(m[1])
+	}
+	if pageType == PAGE_HTML {
+		if m := metaCharsetExp.FindSubmatch(head); m != nil {
+			return string(m[1])
+		}
+	}
+	return ``
+}
+
+// guessCharset 按常用汉字的出现次数在 guessCharsets 中选择最合适的编码，都不合适时返回 windows-1252
+func guessCharset(body []byte) string {
+	best, bestScore := `windows-1252`, 0
+	for _, charset := range guessCharsets {
+		e, err := GetEncoding(charset)
+		if err != nil {
+			continue
+		}
+		decoded, err := e.NewDecoder().Bytes(body)
+		if err != nil {
+			continue
+		}
+		score := 0
+		for _, r := range string(decoded) {
+			switch {
+			case r == utf8.RuneError:
+				score -= 10
+			case strings.ContainsRune(commonHanzi, r):
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = charset, score
+		}
+	}
+	return best
+}
+
+// DetectCharset 识别页面编码。依次根据 BOM、是否为有效的 UTF-8、XML 声明或 <meta> 标签中声明的编码以及常用汉字的出现次数判断
+func DetectCharset(body []byte, pageType string) string {
+	switch {
+	case bytes.HasPrefix(body, []byte{0xEF, 0xBB, 0xBF}):
+		return `utf-8`
+	case bytes.HasPrefix(body, []byte{0xFE, 0xFF}):
+		return `utf-16be`
+	case bytes.HasPrefix(body, []byte{0xFF, 0xFE}):
+		return `utf-16le`
+	}
+	// 抓取时可能已经转为 UTF-8，此时声明的编码已不准确
+	if utf8.Valid(body) {
+		return `utf-8`
+	}
+	if declared := declaredCharset(body, pageType); len(declared) > 0 {
+		if e, err := GetEncoding(declared); err == nil && e != unicode.UTF8 {
+			return charsetName(e)
+		}
+	}
+	return guessCharset(body)
+}
+
+// DecodeCharset 将指定编码的内容转为 UTF-8(会删除 BOM)
+func DecodeCharset(body []byte, charset string) ([]byte, error) {
+	e, err := GetEncoding(charset)
+	if err != nil {
+		return body, err
+	}
+	if e == unicode.UTF8 {
+		return bytes.TrimPrefix(body, []byte{0xEF, 0xBB, 0xBF}), nil
+	}
+	decoded, _, err := transform.Bytes(unicode.BOMOverride(e.NewDecoder()), body)
+	return decoded, err
+}
+
+// SetCharset 设置页面编码。为 auto 时自动识别，为空时使用 DefaultCharset
+func (p *PipeItem) SetCharset(charset string) {
+	p.charset = charset
+}
+
+func (p *PipeItem) Charset() string {
+	return p.charset
+}
+
+// fetchCharset 返回 fetch 抓取的页面使用的编码。charset 为 fetch 参数中指定的编码，
+// 未指定时如果启用了编码转换则自动识别每个页面的编码(不使用当前页面的编码)
+func (p *PipeItem) fetchCharset(charset string) string {
+	if len(charset) > 0 {
+		return charset
+	}
+	if len(p.charset) > 0 || len(DefaultCharset) > 0 {
+		return CharsetAuto
+	}
+	return ``
+}
+
+// decodeBody 将页面内容转为 UTF-8。未设置编码时不转换
+func (p *PipeItem) decodeBody(body []byte, pageType string) ([]byte, error) {
+	charset := p.charset
+	if len(charset) == 0 {
+		charset = DefaultCharset
+	}
+	if len(charset) == 0 {
+		return body, nil
+	}
+	if strings.EqualFold(charset, CharsetAuto) {
+		charset = DetectCharset(body, pageType)
+	}
+	return DecodeCharset(body, charset)
+}
+
+// iconv(gbk,utf-8) => 将GBK编码的内容转为UTF-8
+// 修复乱码(GBK 内容被当作 latin1 解码)：iconv(utf-8,latin1)|iconv(gbk,utf-8)
+func iconv(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	args := SplitParams(params)
+	if len(args) != 2 {
+		return src, errors.New("Filter iconv need two params")
+	}
+	from, err := iconvEncoding(args[0])
+	if err != nil {
+		return src, err
+	}
+	to, err := iconvEncoding(args[1])
+	if err != nil {
+		return src, err
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		decoded, err := from.NewDecoder().String(v)
+		if err != nil {
+			return v, err
+		}
+		return to.NewEncoder().String(decoded)
+	})
+}
@@ -0,0 +1,86 @@
+package gopiper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func TestCharset(t *testing.T) {
+	gbk := func(s string) []byte {
+		b, _ := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(s))
+		return b
+	}
+	html := `<html><head><meta http-equiv="Content-Type" content="text/html; charset=gb2312"></head><body><h1>中文新闻的标题</h1></body></html>`
+	assert.Equal(t, `gbk`, DetectCharset(gbk(html), PAGE_HTML))
+	assert.Equal(t, `utf-8`, DetectCharset([]byte(html), PAGE_HTML)) // 已转为 UTF-8
+	assert.Equal(t, `gb18030`, DetectCharset(gbk(`<h1>这是一个中文网页的标题</h1>`), PAGE_HTML))
+	big5, _ := traditionalchinese.Big5.NewEncoder().Bytes([]byte(`<h1>這是一個中文網頁的標題</h1>`))
+	assert.Equal(t, `big5`, DetectCharset(big5, PAGE_HTML))
+	assert.Equal(t, `gbk`, DetectCharset(gbk(`<?xml version="1.0" encoding="GBK"?><a>中文</a>`), PAGE_TEXT))
+	assert.Equal(t, `utf-16le`, DetectCharset([]byte{0xFF, 0xFE, '{', 0, '}', 0}, PAGE_JSON))
+
+	pipe := PipeItem{Type: PT_TEXT, Selector: `h1`}
+	v, err := pipe.PipeBytes(gbk(html), PAGE_HTML)
+	assert.NoError(t, err)
+	assert.Equal(t, string(gbk(`中文新闻的标题`)), v) // 默认不转换
+	pipe.SetCharset(CharsetAuto)
+	v, err = pipe.PipeBytes(gbk(html), PAGE_HTML)
+	assert.NoError(t, err)
+	assert.Equal(t, `中文新闻的标题`, v)
+	v, err = pipe.PipeBytes(big5, PAGE_HTML)
+	assert.NoError(t, err)
+	assert.Equal(t, `這是一個中文網頁的標題`, v)
+
+	pipe.SetCharset(`big5`)
+	v, err = pipe.PipeBytes(big5, PAGE_HTML)
+	assert.NoError(t, err)
+	assert.Equal(t, `這是一個中文網頁的標題`, v)
+	pipe.SetCharset(`unknown`)
+	_, err = pipe.PipeBytes(big5, PAGE_HTML)
+	assert.Error(t, err)
+
+	pipe = PipeItem{Type: PT_STRING, Selector: `name`}
+	pipe.SetCharset(CharsetAuto)
+	v, err = pipe.PipeBytes(append([]byte{0xEF, 0xBB, 0xBF}, `{"name":"中文"}`...), PAGE_JSON)
+	assert.NoError(t, err)
+	assert.Equal(t, `中文`, v)
+
+	// 抓取的页面各自识别编码
+	pages := map[string][]byte{
+		`gbk`:  gbk(html),
+		`utf8`: []byte(`<html><head><meta charset="gb2312"></head><body><h1>详情页标题</h1></body></html>`),
+		`big5`: big5,
+	}
+	list := PipeItem{Type: PT_TEXT, Selector: `h1`, Filter: `fetch(html,h1)`}
+	list.SetCharset(`gb18030`)
+	list.SetFetcher(func(pageURL string) ([]byte, error) {
+		return pages[pageURL], nil
+	})
+	for name, expected := range map[string]string{`gbk`: `中文新闻的标题`, `utf8`: `详情页标题`, `big5`: `這是一個中文網頁的標題`} {
+		v, err = list.PipeBytes(gbk(`<h1>`+name+`</h1>`), PAGE_HTML)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, v, name)
+	}
+	list.Filter = `fetch(html,h1,utf-8)` // 指定编码时不自动识别
+	v, err = list.PipeBytes(gbk(`<h1>big5</h1>`), PAGE_HTML)
+	assert.NoError(t, err)
+	title, _ := traditionalchinese.Big5.NewEncoder().String(`這是一個中文網頁的標題`)
+	assert.Equal(t, title, v)
+
+	p := &PipeItem{}
+	r, err := p.CallFilter(string(gbk(`中文`)), `iconv(gbk,utf-8)`)
+	assert.NoError(t, err)
+	assert.Equal(t, `中文`, r)
+	r, err = p.CallFilter(`中文`, `iconv(utf-8,gb18030)`)
+	assert.NoError(t, err)
+	assert.Equal(t, string(gbk(`中文`)), r)
+	// 丂 的GBK编码为 0x81 0x40，0x81 在 windows-1252 中没有对应的字符
+	garbled, _ := charmap.ISO8859_1.NewDecoder().String(string(gbk(`中文丂`)))
+	r, err = p.CallFilter(garbled, `iconv(utf-8,latin1)|iconv(gbk,utf-8)`)
+	assert.NoError(t, err)
+	assert.Equal(t, `中文丂`, r)
+}
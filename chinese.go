@@ -0,0 +1,456 @@
+package gopiper
+
+import (
+	_ "embed"
+	"errors"
+	"math/big"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 内置字典由 ICU 的转换规则逐字生成(见 dict 目录中各文件的说明)，只做单字转换，
+// 常见的一对多情况通过 S2TPhrases、T2SPhrases 和 PinyinPhrases 中的词语处理
+
+//go:embed dict/pinyin.txt
+var pinyinData string
+
+//go:embed dict/s2t.txt
+var s2tData string
+
+//go:embed dict/t2s.txt
+var t2sData string
+
+var (
+	// S2TPhrases 简体转繁体时优先匹配的词语。可以添加自定义词语(须在执行规则前添加)
+	S2TPhrases = map[string]string{
+		`头发`: `頭髮`, `理发`: `理髮`, `发型`: `髮型`, `白发`: `白髮`,
+		`干部`: `幹部`, `干活`: `幹活`, `能干`: `能幹`, `干什么`: `幹什麼`, `树干`: `樹幹`,
+		`面条`: `麵條`, `面包`: `麵包`, `方便面`: `方便麵`, `面粉`: `麵粉`,
+		`这里`: `這裡`, `那里`: `那裡`, `哪里`: `哪裡`, `里面`: `裡面`, `心里`: `心裡`,
+		`皇后`: `皇后`, `王后`: `王后`,
+		`手表`: `手錶`, `钟表`: `鐘錶`,
+		`台风`: `颱風`, `一只`: `一隻`, `两只`: `兩隻`,
+		`关系`: `關係`, `联系`: `聯繫`,
+		`复杂`: `複雜`, `重复`: `重複`, `复制`: `複製`,
+		`日历`: `日曆`, `准备`: `準備`, `标准`: `標準`, `老板`: `老闆`,
+		`制造`: `製造`, `其余`: `其餘`, `多余`: `多餘`, `忧郁`: `憂鬱`,
+		`胡子`: `鬍子`, `胡须`: `鬍鬚`, `稻谷`: `稻穀`, `北斗`: `北斗`, `宿舍`: `宿舍`,
+	}
+	// T2SPhrases 繁体转简体时优先匹配的词语
+	T2SPhrases = map[string]string{
+		`乾隆`: `乾隆`, `乾坤`: `乾坤`,
+	}
+	// PinyinPhrases 转换拼音时优先匹配的词语(多音字)，拼音用空格分隔
+	PinyinPhrases = map[string]string{
+		`银行`: `yín háng`, `行业`: `háng yè`, `行长`: `háng zhǎng`,
+		`重庆`: `chóng qìng`, `重新`: `chóng xīn`, `重复`: `chóng fù`,
+		`长大`: `zhǎng dà`, `成长`: `chéng zhǎng`, `校长`: `xiào zhǎng`, `生长`: `shēng zhǎng`,
+		`音乐`: `yīn yuè`, `一只`: `yī zhī`, `觉得`: `jué de`, `睡觉`: `shuì jiào`,
+		`还钱`: `huán qián`, `为了`: `wèi le`, `因为`: `yīn wèi`, `为什么`: `wèi shén me`, `什么`: `shén me`,
+		`目的`: `mù dì`, `的确`: `dí què`, `便宜`: `pián yi`, `参差`: `cēn cī`, `角色`: `jué sè`,
+		`会计`: `kuài jì`, `率领`: `shuài lǐng`, `处理`: `chǔ lǐ`, `种植`: `zhòng zhí`, `首相`: `shǒu xiàng`,
+		`少年`: `shào nián`, `爱好`: `ài hào`, `头发`: `tóu fà`, `理发`: `lǐ fà`, `地方`: `dì fāng`,
+	}
+
+	chineseDictOnce sync.Once
+	pinyinDict      map[rune]string
+	s2tDict         map[rune]rune
+	t2sDict         map[rune]rune
+)
+
+func loadChineseDict() {
+	pinyinDict = map[rune]string{}
+	eachDictLine(pinyinData, func(key string, value string) {
+		for _, r := range value {
+			pinyinDict[r] = key
+		}
+	})
+	s2tDict, t2sDict = map[rune]rune{}, map[rune]rune{}
+	for data, dict := range map[*string]map[rune]rune{&s2tData: s2tDict, &t2sData: t2sDict} {
+		eachDictLine(*data, func(key string, value string) {
+			from, _ := utf8.DecodeRuneInString(key)
+			to, _ := utf8.DecodeRuneInString(value)
+			dict[from] = to
+		})
+	}
+}
+
+// eachDictLine 遍历字典中“键 值”格式的行，忽略空行和以“#”开头的行
+func eachDictLine(data string, fn func(key string, value string)) {
+	for _, line := range strings.Split(data, "\n") {
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if kv := strings.SplitN(line, ` `, 2); len(kv) == 2 {
+			fn(kv[0], kv[1])
+		}
+	}
+}
+
+// maxPhraseLen 返回最长的词语的长度(字节)
+func maxPhraseLen(phrases map[string]string) int {
+	var max int
+	for k := range phrases {
+		if len(k) > max {
+			max = len(k)
+		}
+	}
+	return max
+}
+
+// matchPhrase 返回 s 开头最长的词语。maxLen 为 maxPhraseLen 的结果，从最长的前缀开始查找
+func matchPhrase(s string, phrases map[string]string, maxLen int) (string, string, bool) {
+	if maxLen > len(s) {
+		maxLen = len(s)
+	}
+	for n := maxLen; n > 0; n-- {
+		if v, ok := phrases[s[:n]]; ok {
+			return s[:n], v, true
+		}
+	}
+	return ``, ``, false
+}
+
+func convertChinese(s string, phrases map[string]string, dict map[rune]rune) string {
+	b := strings.Builder{}
+	maxLen := maxPhraseLen(phrases)
+	for i := 0; i < len(s); {
+		if word, value, ok := matchPhrase(s[i:], phrases, maxLen); ok {
+			b.WriteString(value)
+			i += len(word)
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if to, ok := dict[r]; ok {
+			r = to
+		}
+		b.WriteRune(r)
+		i += size
+	}
+	return b.String()
+}
+
+// S2T 简体转繁体
+func S2T(s string) string {
+	chineseDictOnce.Do(loadChineseDict)
+	return convertChinese(s, S2TPhrases, s2tDict)
+}
+
+// T2S 繁体转简体
+func T2S(s string) string {
+	chineseDictOnce.Do(loadChineseDict)
+	return convertChinese(s, T2SPhrases, t2sDict)
+}
+
+// toneMarks 带声调的字母 => 不带声调的字母和声调
+var toneMarks = map[rune][2]rune{
+	'ā': {'a', '1'}, 'á': {'a', '2'}, 'ǎ': {'a', '3'}, 'à': {'a', '4'},
+	'ē': {'e', '1'}, 'é': {'e', '2'}, 'ě': {'e', '3'}, 'è': {'e', '4'},
+	'ī': {'i', '1'}, 'í': {'i', '2'}, 'ǐ': {'i', '3'}, 'ì': {'i', '4'},
+	'ō': {'o', '1'}, 'ó': {'o', '2'}, 'ǒ': {'o', '3'}, 'ò': {'o', '4'},
+	'ū': {'u', '1'}, 'ú': {'u', '2'}, 'ǔ': {'u', '3'}, 'ù': {'u', '4'},
+	'ǖ': {'ü', '1'}, 'ǘ': {'ü', '2'}, 'ǚ': {'ü', '3'}, 'ǜ': {'ü', '4'},
+	'ń': {'n', '2'}, 'ň': {'n', '3'}, 'ǹ': {'n', '4'}, 'ḿ': {'m', '2'},
+}
+
+// 拼音风格
+const (
+	PinyinTone   = `tone`   // 带声调符号，例如 zhōng
+	PinyinNumber = `number` // 声调用数字表示，例如 zhong1(轻声不加数字)
+	PinyinNormal = `normal` // 不带声调，ü 写作 v，例如 zhong、lv
+	PinyinFirst  = `first`  // 首字母，例如 z
+)
+
+func pinyinStyle(syllable string, style string) string {
+	if style == PinyinTone {
+		return syllable
+	}
+	b := strings.Builder{}
+	var tone rune
+	for _, r := range syllable {
+		if m, ok := toneMarks[r]; ok {
+			r, tone = m[0], m[1]
+		}
+		if r == 'ü' && style != PinyinNumber {
+			r = 'v'
+		}
+		b.WriteRune(r)
+	}
+	res := b.String()
+	switch style {
+	case PinyinNumber:
+		if tone > 0 {
+			res += string(tone)
+		}
+	case PinyinFirst:
+		res = res[:1]
+	}
+	return res
+}
+
+// Pinyin 将汉字转为拼音。非汉字的部分原样保留，各部分之间用 sep 分隔
+func Pinyin(s string, style string, sep string) string {
+	chineseDictOnce.Do(loadChineseDict)
+	var (
+		parts []string
+		other strings.Builder
+	)
+	flush := func() {
+		if v := strings.TrimSpace(other.String()); len(v) > 0 {
+			parts = append(parts, v)
+		}
+		other.Reset()
+	}
+	maxLen := maxPhraseLen(PinyinPhrases)
+	for i := 0; i < len(s); {
+		if word, value, ok := matchPhrase(s[i:], PinyinPhrases, maxLen); ok {
+			flush()
+			for _, syllable := range strings.Fields(value) {
+				parts = append(parts, pinyinStyle(syllable, style))
+			}
+			i += len(word)
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if syllable, ok := pinyinDict[r]; ok {
+			flush()
+			parts = append(parts, pinyinStyle(syllable, style))
+			continue
+		}
+		if unicode.Is(unicode.Han, r) { // 字典中没有的汉字
+			flush()
+			parts = append(parts, string(r))
+			continue
+		}
+		other.WriteRune(r)
+	}
+	flush()
+	return strings.Join(parts, sep)
+}
+
+var (
+	chineseNumberExp = regexp.MustCompile(`负?[零〇一壹幺二贰貳两兩三叁參四肆五伍六陆陸七柒八捌九玖十拾百佰千仟万萬亿億]+(?:[点點][零〇一壹幺二贰貳两兩三叁參四肆五伍六陆陸七柒八捌九玖]+)?`)
+	arabicNumberExp  = regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+	wholeNumberExp   = regexp.MustCompile(`^-?\d+(?:\.\d+)?$`)
+
+	chineseNumerals      = [2][]string{{`零`, `一`, `二`, `三`, `四`, `五`, `六`, `七`, `八`, `九`}, {`零`, `壹`, `贰`, `叁`, `肆`, `伍`, `陆`, `柒`, `捌`, `玖`}}
+	chineseSectionUnits  = [2][]string{{``, `十`, `百`, `千`}, {``, `拾`, `佰`, `仟`}}
+	chineseSectionSuffix = []string{``, `万`, `亿`, `万亿`, `亿亿`}
+)
+
+// formatChineseSection 转换0~9999的数字
+func formatChineseSection(n int, upper int) string {
+	b := strings.Builder{}
+	zero := false
+	for i := 3; i >= 0; i-- {
+		d := n / pow10(i) % 10
+		if d == 0 {
+			zero = b.Len() > 0
+			continue
+		}
+		if zero {
+			b.WriteString(chineseNumerals[upper][0])
+			zero = false
+		}
+		b.WriteString(chineseNumerals[upper][d])
+		b.WriteString(chineseSectionUnits[upper][i])
+	}
+	return b.String()
+}
+
+func pow10(n int) int {
+	res := 1
+	for ; n > 0; n-- {
+		res *= 10
+	}
+	return res
+}
+
+// FormatChineseNumber 将数字字符串(例如 2300、-3.14)转为中文数字。upper 为 true 时使用大写数字(壹贰叁)
+func FormatChineseNumber(s string, upper bool) (string, error) {
+	s = strings.TrimSpace(s)
+	if !wholeNumberExp.MatchString(s) {
+		return s, ErrInvalidNumber
+	}
+	style := 0
+	if upper {
+		style = 1
+	}
+	b := strings.Builder{}
+	if strings.HasPrefix(s, `-`) {
+		b.WriteString(`负`)
+		s = s[1:]
+	}
+	intPart, fracPart := s, ``
+	if pos := strings.Index(s, `.`); pos >= 0 {
+		intPart, fracPart = s[:pos], s[pos+1:]
+	}
+	n, ok := new(big.Int).SetString(intPart, 10)
+	if !ok {
+		return s, ErrInvalidNumber
+	}
+	var sections []int
+	tenThousand := big.NewInt(10000)
+	for n.Sign() > 0 {
+		mod := new(big.Int)
+		n.DivMod(n, tenThousand, mod)
+		sections = append(sections, int(mod.Int64()))
+	}
+	if len(sections) > len(chineseSectionSuffix) {
+		return s, errors.New("Number is too large")
+	}
+	if len(sections) == 0 {
+		b.WriteString(chineseNumerals[style][0])
+	}
+	zero := false
+	for i := len(sections) - 1; i >= 0; i-- {
+		section := sections[i]
+		if section == 0 {
+			zero = true
+			continue
+		}
+		if zero || (i < len(sections)-1 && section < 1000) {
+			b.WriteString(chineseNumerals[style][0])
+		}
+		zero = false
+		text := formatChineseSection(section, style)
+		if style == 0 && i == len(sections)-1 && section >= 10 && section < 20 {
+			text = strings.TrimPrefix(text, `一`) // 十五而不是一十五
+		}
+		b.WriteString(text)
+		b.WriteString(chineseSectionSuffix[i])
+	}
+	if len(fracPart) > 0 {
+		b.WriteString(`点`)
+		for _, r := range fracPart {
+			b.WriteString(chineseNumerals[style][r-'0'])
+		}
+	}
+	return b.String(), nil
+}
+
+// s2t => src="中国" => "中國"
+func s2t(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return S2T(v), nil
+	})
+}
+
+// t2s => src="中國" => "中国"
+func t2s(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return T2S(v), nil
+	})
+}
+
+// pinyin(normal,-) => src="中国" => "zhong-guo"
+func pinyin(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	style, sep := PinyinTone, ` `
+	args := strings.SplitN(params, `,`, 2)
+	if v := strings.TrimSpace(args[0]); len(v) > 0 {
+		style = v
+	}
+	switch style {
+	case PinyinTone, PinyinNumber, PinyinNormal:
+	case PinyinFirst:
+		sep = ``
+	default:
+		return src, errors.New("Filter pinyin unsupported style: " + style)
+	}
+	if len(args) == 2 {
+		sep = args[1]
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return Pinyin(v, style, sep), nil
+	})
+}
+
+// cn2num => src="二千三百" => 2300
+// cn2num(text) => src="第二十三章" => "第23章"
+func cn2num(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	inText := strings.TrimSpace(params) == `text`
+	if items, ok := src.([]string); ok && !inText { // 结果为数值
+		src, _ = toInterfaceSlice(items)
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		if !inText {
+			n, err := ParseChineseNumber(v)
+			if err != nil {
+				return v, err
+			}
+			return numberResult(n), nil
+		}
+		return chineseNumberInText(v), nil
+	})
+}
+
+// ChineseMeasureWords cn2num(text) 中后接这些字时，单个中文数字(例如“一个”、“三章”)也会被转换
+var ChineseMeasureWords = `个章节回集卷页篇册本部元块角岁年月日号天周次名位件条张只台辆层`
+
+// chineseNumberInText 将文本中明确表示数值的中文数字转为阿拉伯数字。
+// 为避免转换词语中的数字(例如“统一”、“一些”、“三五个”、“万一”)，只转换：
+// 带有十/百/千等单位的数字(单个“十”除外)、第N或后接量词的单个数字、包含〇/零或不少于三位的逐位读的数字
+func chineseNumberInText(v string) string {
+	b := strings.Builder{}
+	last := 0
+	for _, loc := range chineseNumberExp.FindAllStringIndex(v, -1) {
+		s := v[loc[0]:loc[1]]
+		if !isNumberInText(s, v[:loc[0]], v[loc[1]:]) {
+			continue
+		}
+		n, err := ParseChineseNumber(s)
+		if err != nil {
+			continue
+		}
+		b.WriteString(v[last:loc[0]])
+		b.WriteString(exprString(numberResult(n)))
+		last = loc[1]
+	}
+	b.WriteString(v[last:])
+	return b.String()
+}
+
+func isNumberInText(s string, before string, after string) bool {
+	runes := []rune(strings.TrimPrefix(s, `负`))
+	if len(runes) == 1 {
+		next, _ := utf8.DecodeRuneInString(after)
+		return strings.HasSuffix(before, `第`) || strings.ContainsRune(ChineseMeasureWords, next)
+	}
+	for _, r := range runes {
+		if _, ok := chineseDigits[r]; !ok {
+			return true // 带有单位或小数点，例如：二十三、三点五
+		}
+	}
+	return len(runes) >= 3 || strings.ContainsAny(s, `〇零`) // 例如：二〇二四
+}
+
+// num2cn => src=2300 => "二千三百"
+// num2cn(upper) => src=2300 => "贰仟叁佰"
+// num2cn(text) => src="第23章" => "第二十三章"
+func num2cn(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	var upper, inText bool
+	for _, param := range SplitParams(params) {
+		switch strings.TrimSpace(param) {
+		case `upper`:
+			upper = true
+		case `text`:
+			inText = true
+		}
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		if !inText {
+			return FormatChineseNumber(v, upper)
+		}
+		return arabicNumberExp.ReplaceAllStringFunc(v, func(s string) string {
+			res, err := FormatChineseNumber(s, upper)
+			if err != nil {
+				return s
+			}
+			return res
+		}), nil
+	})
+}
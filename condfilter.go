@@ -0,0 +1,154 @@
+package gopiper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// nilFilters 可以处理空值(nil)的过滤器。过滤器链中包含这些过滤器时，值为 nil 也会执行过滤器链
+var nilFilters = map[string]bool{
+	`default`:  true,
+	`coalesce`: true,
+	`if`:       true,
+	`switch`:   true,
+}
+
+func acceptsNil(value string) bool {
+	for _, call := range parseFilters(value) {
+		if nilFilters[call.name] {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTopLevel 按分隔符分割参数，括号((、[、{)中的分隔符不分割
+func splitTopLevel(params string, sep byte) []string {
+	var (
+		parts []string
+		depth int
+		start int
+	)
+	for i := 0; i < len(params); i++ {
+		if i > 0 && params[i-1] == '\\' {
+			continue
+		}
+		switch params[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth > 0 {
+				depth--
+			}
+		case sep:
+			if depth == 0 {
+				parts = append(parts, params[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, params[start:])
+}
+
+// runBranch 执行分支：以“=”开头时返回其后的值(按JSON解析，否则作为字符串)，否则作为过滤器链执行，为空时返回原值
+func runBranch(pipe *PipeItem, src interface{}, branch string) (interface{}, error) {
+	branch = strings.TrimSpace(branch)
+	if strings.HasPrefix(branch, `=`) {
+		return parseParamValue(pipe.resolveValue(branch[1:])), nil
+	}
+	if len(branch) == 0 {
+		return src, nil
+	}
+	return runFilters(pipe, src, branch, true)
+}
+
+// if(. contains free,=0,floatval) => src="free" => 0
+// if(contains free,=0,floatval) => src="12.5" => 12.5
+func ifFilter(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	args := splitTopLevel(params, ',')
+	if len(args) < 2 || len(args) > 3 {
+		return src, errors.New("Filter if need two or three params")
+	}
+	c, err := parseCondition(pipe.resolveValue(args[0]))
+	if err != nil {
+		return src, err
+	}
+	if c.match(src) {
+		return runBranch(pipe, src, args[1])
+	}
+	if len(args) == 3 {
+		return runBranch(pipe, src, args[2])
+	}
+	return src, nil
+}
+
+// default(0) => src="" => 0
+func defaultFilter(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	if isEmptyValue(src) {
+		return parseParamValue(params), nil
+	}
+	return src, nil
+}
+
+// coalesce(get(price),get(sale_price),=0) => src={"price":"","sale_price":"9.9"} => "9.9"
+func coalesce(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	for _, branch := range splitTopLevel(params, ',') {
+		v, err := runBranch(pipe, src, branch)
+		if err != nil {
+			if isAbort(err) {
+				return src, err
+			}
+			continue
+		}
+		if !isEmptyValue(v) {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// switch(^free$=>=0,万$=>floatval,=-1) => src="3.2万" => 32000
+// 参数为“正则表达式=>分支”，最后一个不带“=>”的参数为默认分支
+func switchFilter(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	text := ``
+	if src != nil {
+		text = fmt.Sprint(src)
+	}
+	for _, item := range splitTopLevel(params, ',') {
+		idx := strings.Index(item, `=>`)
+		if idx < 0 {
+			return runBranch(pipe, src, item)
+		}
+		re, err := pipe.compileRegexp2(strings.TrimSpace(pipe.resolveValue(item[:idx])))
+		if err != nil {
+			return src, err
+		}
+		matched, err := re.MatchString(text)
+		if err != nil {
+			return src, regexp2Error(re, err)
+		}
+		if matched {
+			return runBranch(pipe, src, item[idx+2:])
+		}
+	}
+	return src, nil
+}
+
+// pipeCoalesce 依次执行子规则，返回第一个非空的结果
+func (p *PipeItem) pipeCoalesce(run func(subitem *PipeItem) (interface{}, error)) (interface{}, error) {
+	if len(p.SubItem) == 0 {
+		return nil, ErrCoalesceNeedSubItem
+	}
+	for _, subitem := range p.SubItem {
+		subitem.CopyFrom(p)
+		v, err := run(&subitem)
+		if isAbort(err) {
+			return nil, err
+		}
+		if err == nil && !isEmptyValue(v) {
+			return callFilter(p, v, p.Filter)
+		}
+	}
+	return callFilter(p, nil, p.Filter)
+}
@@ -0,0 +1,473 @@
+package gopiper
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webx-top/com"
+)
+
+// DefaultTimezone datetime 类型和过滤器默认使用的时区
+var DefaultTimezone = time.Local
+
+// DefaultDateTimeLayouts datetime 默认尝试的日期格式(按顺序)
+var DefaultDateTimeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	`2006-01-02T15:04:05`,
+	`2006-01-02T15:04`,
+	`2006-1-2 15:04:05.999999999`,
+	`2006-1-2 15:04:05`,
+	`2006-1-2 15:04`,
+	`2006-1-2`,
+	`2006/1/2 15:04:05`,
+	`2006/1/2 15:04`,
+	`2006/1/2`,
+	`2006.1.2 15:04:05`,
+	`2006.1.2 15:04`,
+	`2006.1.2`,
+	`1-2 15:04:05`,
+	`1-2 15:04`,
+	`1-2`,
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+	time.UnixDate,
+	time.RubyDate,
+	time.ANSIC,
+	`Mon, 2 Jan 2006 15:04:05 -0700`,
+	`Mon, 2 Jan 2006 15:04:05 MST`,
+	`January 2, 2006 15:04:05`,
+	`January 2, 2006 15:04`,
+	`January 2, 2006 3:04 PM`,
+	`January 2, 2006 3:04PM`,
+	`January 2, 2006`,
+	`January 2 2006`,
+	`Jan 2, 2006 15:04:05`,
+	`Jan 2, 2006 15:04`,
+	`Jan 2, 2006 3:04 PM`,
+	`Jan 2, 2006 3:04PM`,
+	`Jan 2, 2006`,
+	`Jan 2 2006`,
+	`Monday, January 2, 2006`,
+	`Mon, January 2, 2006`,
+	`Mon, Jan 2, 2006`,
+	`2 January 2006 15:04`,
+	`2 January 2006`,
+	`2 Jan 2006 15:04`,
+	`2 Jan 2006`,
+	`January 2`,
+	`Jan 2`,
+	`1/2/2006 15:04:05`,
+	`1/2/2006 15:04`,
+	`1/2/2006`,
+	`20060102150405`,
+	`20060102`,
+}
+
+var timeNow = time.Now
+
+var (
+	ordinalExp      = regexp.MustCompile(`(?i)\b(\d{1,2})(st|nd|rd|th)\b`)
+	enAgoExp        = regexp.MustCompile(`(?i)^(\d+|an?|one)\s*(second|sec|minute|min|hour|hr|day|week|month|year)s?\s+ago$`)
+	enInExp         = regexp.MustCompile(`(?i)^in\s+(\d+|an?|one)\s*(second|sec|minute|min|hour|hr|day|week|month|year)s?$`)
+	enDayExp        = regexp.MustCompile(`(?i)^(today|yesterday|tomorrow)(?:\s*(?:at|,)?\s*(.+))?$`)
+	zhAgoExp        = regexp.MustCompile(`^([\d零〇一二两三四五六七八九十百]+|半)\s*(秒钟?|分钟|个?小时|个?钟头|天|日|周|个?星期|个?礼拜|个?月|年)(?:前|之前|以前)$`)
+	zhAfterExp      = regexp.MustCompile(`^([\d零〇一二两三四五六七八九十百]+|半)\s*(秒钟?|分钟|个?小时|个?钟头|天|日|周|个?星期|个?礼拜|个?月|年)(?:后|之后|以后)$`)
+	zhDayExp        = regexp.MustCompile(`^(今天|今日|昨天|昨日|前天|明天|明日|后天)\s*(.*)$`)
+	zhPeriodExp     = regexp.MustCompile(`(凌晨|早上|早晨|上午|中午|下午|傍晚|晚上|夜里|夜间)`)
+	zhDateSepExp    = regexp.MustCompile(`(\d)\s*[年月]\s*`)
+	zhDayEndExp     = regexp.MustCompile(`(\d)\s*[日号]\s*`)
+	zhTimeSepExp    = regexp.MustCompile(`(\d)\s*(?:时|点|分)\s*`)
+	zhHalfHourExp   = regexp.MustCompile(`(\d)\s*(?:时|点)\s*半`)
+	zhSecondEndExp  = regexp.MustCompile(`(\d)\s*秒`)
+	trailingColonEx = regexp.MustCompile(`:\s*$`)
+	timezoneExp     = regexp.MustCompile(`^(?i)(?:UTC|GMT)?\s*([+-])(\d{1,2})(?::?(\d{2}))?$`)
+	weekdayPrefix   = regexp.MustCompile(`^(星期|周|礼拜)[一二三四五六日天]\s*`)
+)
+
+// LoadTimezone 加载时区。支持 Asia/Shanghai、UTC、Local 以及 +08:00、UTC+8 这样的偏移量
+func LoadTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	switch strings.ToLower(name) {
+	case ``:
+		return DefaultTimezone, nil
+	case `local`:
+		return time.Local, nil
+	case `utc`, `gmt`, `z`:
+		return time.UTC, nil
+	}
+	if m := timezoneExp.FindStringSubmatch(name); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3])
+		offset := hours*3600 + minutes*60
+		if m[1] == `-` {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	}
+	return time.LoadLocation(name)
+}
+
+// ParseDateTime 解析日期时间。依次尝试：时间戳数字、相对时间(英文和中文)、中文日期以及 layouts 和 DefaultDateTimeLayouts 中的格式。
+// 没有时区信息的日期按 loc 解析
+func ParseDateTime(s string, loc *time.Location, layouts ...string) (time.Time, error) {
+	if loc == nil {
+		loc = DefaultTimezone
+	}
+	now := timeNow().In(loc)
+	s = strings.TrimSpace(_tosbc(s))
+	if len(s) == 0 {
+		return time.Time{}, errors.New("datetime: empty value")
+	}
+	if t, ok := parseTimestamp(s); ok {
+		return t.In(loc), nil
+	}
+	if t, ok := parseRelativeTime(s, now); ok {
+		return t, nil
+	}
+	normalized := normalizeDateTime(s)
+	var (
+		t   time.Time
+		err error
+	)
+	if len(layouts) > 0 {
+		layouts = resolveLayouts(layouts)
+		if t, err = parseDateTimeLayouts(normalized, loc, now, layouts); err == nil {
+			return t, nil
+		}
+		if normalized != s {
+			if t, err = parseDateTimeLayouts(s, loc, now, layouts); err == nil {
+				return t, nil
+			}
+		}
+	}
+	if t, err = parseDateTimeLayouts(normalized, loc, now, DefaultDateTimeLayouts); err == nil {
+		return t, nil
+	}
+	return t, errors.New("datetime: unable to parse: " + s)
+}
+
+// resolveLayouts 将 DateTime 等格式名称或 Y-m-d 这样的格式转换为Go的日期格式
+func resolveLayouts(layouts []string) []string {
+	resolved := make([]string, len(layouts))
+	for i, layout := range layouts {
+		resolved[i] = resolveLayout(layout)
+	}
+	return resolved
+}
+
+func resolveLayout(layout string) string {
+	layout = strings.TrimSpace(layout)
+	if v, y := timeFormatNames[layout]; y {
+		return v
+	}
+	return com.ConvDateFormat(layout)
+}
+
+func parseDateTimeLayouts(s string, loc *time.Location, now time.Time, layouts []string) (time.Time, error) {
+	var err error
+	for _, layout := range layouts {
+		var t time.Time
+		t, err = time.ParseInLocation(layout, s, loc)
+		if err != nil {
+			continue
+		}
+		if t.Year() == 0 { // 没有年份时使用今年
+			t = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		}
+		return t, nil
+	}
+	return time.Time{}, err
+}
+
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return time.Time{}, false
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	switch len(s) {
+	case 10:
+		return time.Unix(n, 0), true
+	case 13:
+		return time.UnixMilli(n), true
+	}
+	return time.Time{}, false
+}
+
+func relativeAmount(v string) (float64, bool) {
+	switch strings.ToLower(v) {
+	case `a`, `an`, `one`:
+		return 1, true
+	case `半`:
+		return 0.5, true
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		return float64(n), true
+	}
+	if n, ok := simpleChineseNumber(v); ok {
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// simpleChineseNumber 转换一百以内的中文数字，例如：三、十五、二十三
+func simpleChineseNumber(s string) (int, bool) {
+	digits := map[rune]int{'零': 0, '〇': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+	var result, current int
+	for _, r := range s {
+		if d, ok := digits[r]; ok {
+			current = d
+			continue
+		}
+		switch r {
+		case '十':
+			if current == 0 {
+				current = 1
+			}
+			result += current * 10
+			current = 0
+		case '百':
+			if current == 0 {
+				current = 1
+			}
+			result += current * 100
+			current = 0
+		default:
+			return 0, false
+		}
+	}
+	return result + current, true
+}
+
+func addRelative(now time.Time, amount float64, unit string) time.Time {
+	unit = strings.TrimPrefix(strings.ToLower(unit), `个`)
+	switch unit {
+	case `second`, `sec`, `秒`, `秒钟`:
+		return now.Add(time.Duration(amount * float64(time.Second)))
+	case `minute`, `min`, `分钟`:
+		return now.Add(time.Duration(amount * float64(time.Minute)))
+	case `hour`, `hr`, `小时`, `钟头`:
+		return now.Add(time.Duration(amount * float64(time.Hour)))
+	case `day`, `天`, `日`:
+		// 整天按日历日计算(跨夏令时也保持时刻不变)，不足一天的部分按24小时计算
+		days := math.Trunc(amount)
+		return now.AddDate(0, 0, int(days)).Add(time.Duration((amount - days) * 24 * float64(time.Hour)))
+	case `week`, `周`, `星期`, `礼拜`:
+		return addRelative(now, amount*7, `day`)
+	case `month`, `月`:
+		// 不足一个月的部分按每月30天计算，例如“半个月前”
+		months := math.Trunc(amount)
+		return now.AddDate(0, int(months), 0).Add(time.Duration((amount - months) * 30 * 24 * float64(time.Hour)))
+	case `year`, `年`:
+		return addRelative(now, amount*12, `month`)
+	}
+	return now
+}
+
+func parseRelativeTime(s string, now time.Time) (time.Time, bool) {
+	lower := strings.ToLower(s)
+	switch lower {
+	case `now`, `just now`, `刚刚`, `刚才`, `现在`:
+		return now, true
+	}
+	if m := enAgoExp.FindStringSubmatch(s); m != nil {
+		if n, ok := relativeAmount(m[1]); ok {
+			return addRelative(now, -n, m[2]), true
+		}
+	}
+	if m := enInExp.FindStringSubmatch(s); m != nil {
+		if n, ok := relativeAmount(m[1]); ok {
+			return addRelative(now, n, m[2]), true
+		}
+	}
+	if m := zhAgoExp.FindStringSubmatch(s); m != nil {
+		if n, ok := relativeAmount(m[1]); ok {
+			return addRelative(now, -n, m[2]), true
+		}
+	}
+	if m := zhAfterExp.FindStringSubmatch(s); m != nil {
+		if n, ok := relativeAmount(m[1]); ok {
+			return addRelative(now, n, m[2]), true
+		}
+	}
+	var (
+		days   int
+		clock  string
+		dayHit bool
+	)
+	if m := enDayExp.FindStringSubmatch(s); m != nil {
+		dayHit, clock = true, m[2]
+		switch strings.ToLower(m[1]) {
+		case `yesterday`:
+			days = -1
+		case `tomorrow`:
+			days = 1
+		}
+	} else if m := zhDayExp.FindStringSubmatch(s); m != nil {
+		dayHit, clock = true, m[2]
+		switch m[1] {
+		case `昨天`, `昨日`:
+			days = -1
+		case `前天`:
+			days = -2
+		case `明天`, `明日`:
+			days = 1
+		case `后天`:
+			days = 2
+		}
+	}
+	if !dayHit {
+		return time.Time{}, false
+	}
+	day := now.AddDate(0, 0, days)
+	clock = strings.TrimSpace(clock)
+	if len(clock) == 0 {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, now.Location()), true
+	}
+	clock = normalizeDateTime(clock)
+	for _, layout := range []string{`15:04:05`, `15:04`, `3:04 PM`, `3:04PM`, `3PM`, `3 PM`, `15`} {
+		t, err := time.Parse(layout, clock)
+		if err == nil {
+			return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, now.Location()), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// normalizeDateTime 将中文日期、序数词等转换为便于解析的格式。例如：
+// 2024年5月3日 下午2点30分 => 2024-5-3 14:30
+// May 3rd, 2024 => May 3, 2024
+func normalizeDateTime(s string) string {
+	s = ordinalExp.ReplaceAllString(s, `$1`)
+	s = weekdayPrefix.ReplaceAllString(s, ``)
+	period := zhPeriodExp.FindString(s)
+	if len(period) > 0 {
+		s = strings.Replace(s, period, ` `, 1)
+	}
+	s = zhHalfHourExp.ReplaceAllString(s, `$1:30`)
+	s = zhDateSepExp.ReplaceAllString(s, `$1-`)
+	s = zhDayEndExp.ReplaceAllString(s, `$1 `)
+	s = zhSecondEndExp.ReplaceAllString(s, `$1`)
+	s = zhTimeSepExp.ReplaceAllString(s, `$1:`)
+	s = trailingColonEx.ReplaceAllString(s, ``)
+	s = strings.Join(strings.Fields(s), ` `)
+	s = strings.TrimSuffix(s, `-`)
+	// 只有小时的时间补上分钟，例如：2024-5-3 14 => 2024-5-3 14:00
+	if len(period) > 0 || strings.ContainsAny(s, `:`) {
+		s = adjustClock(s, period)
+	}
+	return s
+}
+
+var clockExp = regexp.MustCompile(`(^|\s)(\d{1,2})(:\d{2})?(:\d{2})?$`)
+
+func adjustClock(s string, period string) string {
+	m := clockExp.FindStringSubmatchIndex(s)
+	if m == nil {
+		return s
+	}
+	hour, _ := strconv.Atoi(s[m[4]:m[5]])
+	switch period {
+	case `下午`, `傍晚`, `晚上`, `夜里`, `夜间`:
+		if hour < 12 {
+			hour += 12
+		}
+	case `中午`:
+		if hour < 11 {
+			hour += 12
+		}
+	case `凌晨`:
+		if hour == 12 {
+			hour = 0
+		}
+	}
+	rest := `:00`
+	if m[6] >= 0 {
+		rest = s[m[6]:]
+	}
+	return s[:m[4]] + strconv.Itoa(hour) + rest
+}
+
+// FormatDateTime 按指定格式输出。output 为 rfc3339(默认)、unix、unixmill 或日期格式(例如 Y-m-d H:i:s、DateTime、2006-01-02)
+func FormatDateTime(t time.Time, output string) interface{} {
+	switch strings.ToLower(strings.TrimSpace(output)) {
+	case ``, `rfc3339`:
+		return t.Format(time.RFC3339)
+	case `unix`:
+		return t.Unix()
+	case `unixmill`, `unixmilli`, `millis`:
+		return t.UnixMilli()
+	}
+	return t.Format(resolveLayout(output))
+}
+
+// datetime(output,timezone,layout1;layout2)
+// datetime => src="3 小时前" => "2024-05-03T11:20:00+08:00"
+// datetime(unix,Asia/Shanghai,Y年m月d日) => src="2024年05月03日" => 1714665600
+func datetime(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	var (
+		output   string
+		timezone string
+		layouts  []string
+	)
+	paramList := SplitParams(params, `,`)
+	switch len(paramList) {
+	case 3:
+		for _, layout := range strings.Split(paramList[2], `;`) {
+			if layout = strings.TrimSpace(layout); len(layout) > 0 {
+				layouts = append(layouts, layout)
+			}
+		}
+		fallthrough
+	case 2:
+		timezone = paramList[1]
+		fallthrough
+	case 1:
+		output = paramList[0]
+	}
+	loc, err := LoadTimezone(timezone)
+	if err != nil {
+		return src, err
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		t, err := ParseDateTime(v, loc, layouts...)
+		if err != nil {
+			return v, err
+		}
+		return FormatDateTime(t, output), nil
+	})
+}
+
+func text2datetime(text interface{}) (interface{}, error) {
+	switch val := text.(type) {
+	case string:
+		t, err := ParseDateTime(val, DefaultTimezone)
+		if err != nil {
+			return nil, err
+		}
+		return FormatDateTime(t, ``), nil
+	case []string:
+		vs := make([]string, 0, len(val))
+		for _, v := range val {
+			t, err := ParseDateTime(v, DefaultTimezone)
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, t.Format(time.RFC3339))
+		}
+		return vs, nil
+	}
+	return nil, ErrUnsupportText2datetimeType
+}
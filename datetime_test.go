@@ -0,0 +1,91 @@
+package gopiper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDateTime(t *testing.T) {
+	loc := time.FixedZone(`CST`, 8*3600)
+	now := time.Date(2024, 5, 3, 14, 30, 0, 0, loc)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	tests := map[string]time.Time{
+		`2024-05-03T10:20:30+08:00`: time.Date(2024, 5, 3, 10, 20, 30, 0, loc),
+		`2024-5-3 10:20`:            time.Date(2024, 5, 3, 10, 20, 0, 0, loc),
+		`2024/05/03`:                time.Date(2024, 5, 3, 0, 0, 0, 0, loc),
+		`2024年5月3日`:                 time.Date(2024, 5, 3, 0, 0, 0, 0, loc),
+		`2024年5月3日 14:20`:           time.Date(2024, 5, 3, 14, 20, 0, 0, loc),
+		`2024年5月3日 下午2点30分`:         time.Date(2024, 5, 3, 14, 30, 0, 0, loc),
+		`5月1日`:                      time.Date(2024, 5, 1, 0, 0, 0, 0, loc),
+		`May 3rd, 2024`:             time.Date(2024, 5, 3, 0, 0, 0, 0, loc),
+		`1st January 2024`:          time.Date(2024, 1, 1, 0, 0, 0, 0, loc),
+		`3 小时前`:                     now.Add(-3 * time.Hour),
+		`三天前`:                       now.AddDate(0, 0, -3),
+		`半小时前`:                      now.Add(-30 * time.Minute),
+		`半个月前`:                      now.AddDate(0, 0, -15),
+		`半年前`:                       now.AddDate(0, -6, 0),
+		`刚刚`:                        now,
+		`昨天 14:20`:                  time.Date(2024, 5, 2, 14, 20, 0, 0, loc),
+		`前天`:                        time.Date(2024, 5, 1, 0, 0, 0, 0, loc),
+		`5 minutes ago`:             now.Add(-5 * time.Minute),
+		`an hour ago`:               now.Add(-time.Hour),
+		`yesterday at 9:15 PM`:      time.Date(2024, 5, 2, 21, 15, 0, 0, loc),
+		`1714717800`:                time.Date(2024, 5, 3, 14, 30, 0, 0, loc),
+	}
+	for input, expected := range tests {
+		v, err := ParseDateTime(input, loc)
+		if assert.NoError(t, err, input) {
+			assert.True(t, expected.Equal(v), `%s: %v != %v`, input, v, expected)
+		}
+	}
+
+	// 跨夏令时按日历日计算
+	if ny, err := time.LoadLocation(`America/New_York`); err == nil {
+		now = time.Date(2024, 3, 11, 12, 0, 0, 0, ny)
+		for input, expected := range map[string]time.Time{
+			`1 day ago`:  time.Date(2024, 3, 10, 12, 0, 0, 0, ny),
+			`2天前`:        time.Date(2024, 3, 9, 12, 0, 0, 0, ny),
+			`1 week ago`: time.Date(2024, 3, 4, 12, 0, 0, 0, ny),
+		} {
+			v, err := ParseDateTime(input, ny)
+			if assert.NoError(t, err, input) {
+				assert.True(t, expected.Equal(v), `%s: %v != %v`, input, v, expected)
+			}
+		}
+		now = time.Date(2024, 5, 3, 14, 30, 0, 0, loc)
+	}
+
+	_, err := ParseDateTime(`not a date`, loc)
+	assert.Error(t, err)
+
+	v, err := ParseDateTime(`03/05/2024`, loc, `d/m/Y`)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 3, 0, 0, 0, 0, loc), v)
+}
+
+func TestDateTimeFilter(t *testing.T) {
+	pipe := &PipeItem{}
+	v, err := datetime(pipe, `2024年5月3日 14:20`, `unix,+08:00`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1714717200), v)
+
+	v, err = datetime(pipe, `2024-05-03 14:20`, `rfc3339,UTC`)
+	assert.NoError(t, err)
+	assert.Equal(t, `2024-05-03T14:20:00Z`, v)
+
+	v, err = datetime(pipe, `May 3rd, 2024`, `Y/m/d,UTC`)
+	assert.NoError(t, err)
+	assert.Equal(t, `2024/05/03`, v)
+
+	v, err = datetime(pipe, `03.05.2024`, `unixmill,UTC,d.m.Y`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1714694400000), v)
+
+	v, err = datetime(pipe, []string{`2024-05-03`, `2024-05-04`}, `Y-m-d,UTC`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`2024-05-03`, `2024-05-04`}, v)
+}
@@ -0,0 +1,181 @@
+package gopiper
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	neturl "net/url"
+	"strings"
+)
+
+// hashFuncs hmac 过滤器支持的哈希算法
+var hashFuncs = map[string]func() hash.Hash{
+	`md5`:    md5.New,
+	`sha1`:   sha1.New,
+	`sha256`: sha256.New,
+	`sha512`: sha512.New,
+}
+
+// UUIDNamespaces uuid5 过滤器内置的命名空间(RFC 4122)
+var UUIDNamespaces = map[string]string{
+	`dns`:  `6ba7b810-9dad-11d1-80b4-00c04fd430c8`,
+	`url`:  `6ba7b811-9dad-11d1-80b4-00c04fd430c8`,
+	`oid`:  `6ba7b812-9dad-11d1-80b4-00c04fd430c8`,
+	`x500`: `6ba7b814-9dad-11d1-80b4-00c04fd430c8`,
+}
+
+func hashHex(h hash.Hash, v string) string {
+	h.Write([]byte(v))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// md5 => src="abc" => "900150983cd24fb0d6963f7d28e17f72"
+func md5Filter(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return hashHex(md5.New(), v), nil
+	})
+}
+
+// sha1 => src="abc" => "a9993e364706816aba3e25717850c26c9cd0d89d"
+func sha1Filter(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return hashHex(sha1.New(), v), nil
+	})
+}
+
+// sha256 => src="abc" => "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+func sha256Filter(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return hashHex(sha256.New(), v), nil
+	})
+}
+
+// hmac(key,sha1) => HMAC-SHA1 十六进制摘要。算法默认为 sha256
+func hmacFilter(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	key, algo := params, `sha256`
+	if pos := strings.LastIndex(params, `,`); pos >= 0 {
+		if _, ok := hashFuncs[strings.ToLower(strings.TrimSpace(params[pos+1:]))]; ok {
+			key, algo = params[:pos], strings.ToLower(strings.TrimSpace(params[pos+1:]))
+		}
+	}
+	if len(key) == 0 {
+		return src, fmt.Errorf("Filter hmac need key")
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return hashHex(hmac.New(hashFuncs[algo], []byte(key)), v), nil
+	})
+}
+
+// base64encode => src="abc" => "YWJj"
+// base64encode(url) 使用URL安全的字符集
+func base64encode(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	enc := base64.StdEncoding
+	if strings.TrimSpace(params) == `url` {
+		enc = base64.URLEncoding
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return enc.EncodeToString([]byte(v)), nil
+	})
+}
+
+// base64decode => src="YWJj" => "abc"
+// 自动识别标准字符集和URL安全字符集，可省略末尾的“=”
+func base64decode(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterValue(src, func(v string) (interface{}, error) {
+		v = strings.TrimRight(strings.TrimSpace(v), `=`)
+		enc := base64.RawStdEncoding
+		if strings.ContainsAny(v, `-_`) {
+			enc = base64.RawURLEncoding
+		}
+		b, err := enc.DecodeString(v)
+		if err != nil {
+			return v, err
+		}
+		return string(b), nil
+	})
+}
+
+// urlencode => src="a b&c" => "a+b%26c"
+// urlencode(path) => src="a b&c" => "a%20b&c"
+func urlencode(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	escape := neturl.QueryEscape
+	if strings.TrimSpace(params) == `path` {
+		escape = neturl.PathEscape
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return escape(v), nil
+	})
+}
+
+// urldecode => src="a+b%26c" => "a b&c"
+// urldecode(path) 不会将“+”解码为空格
+func urldecode(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	unescape := neturl.QueryUnescape
+	if strings.TrimSpace(params) == `path` {
+		unescape = neturl.PathUnescape
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return unescape(v)
+	})
+}
+
+// hex => src="abc" => "616263"
+func hexFilter(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return hex.EncodeToString([]byte(v)), nil
+	})
+}
+
+// crc32 => src="abc" => "352441c2"
+func crc32Filter(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(v))), nil
+	})
+}
+
+func parseUUID(s string) ([]byte, bool) {
+	s = strings.Replace(strings.Trim(strings.TrimSpace(s), `{}`), `-`, ``, -1)
+	if len(s) != 32 {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// UUID5 根据命名空间和名称生成第5版UUID(RFC 4122，基于SHA-1)，相同的输入总是生成相同的UUID
+func UUID5(namespace []byte, name string) string {
+	h := sha1.New()
+	h.Write(namespace)
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+	u[6] = (u[6] & 0x0f) | 0x50 // version 5
+	u[8] = (u[8] & 0x3f) | 0x80 // variant RFC 4122
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// uuid5(url) => src="https://www.admpub.com/" => 基于URL命名空间的UUID
+// 参数为 dns、url、oid、x500 或UUID格式的命名空间，其它字符串会先基于URL命名空间转为UUID，不指定时使用 url
+func uuid5(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	name := strings.TrimSpace(params)
+	if len(name) == 0 {
+		name = `url`
+	}
+	if v, ok := UUIDNamespaces[strings.ToLower(name)]; ok {
+		name = v
+	}
+	namespace, ok := parseUUID(name)
+	if !ok {
+		urlNamespace, _ := parseUUID(UUIDNamespaces[`url`])
+		namespace, _ = parseUUID(UUID5(urlNamespace, name))
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return UUID5(namespace, v), nil
+	})
+}
@@ -1,19 +1,47 @@
 package gopiper
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
-	ErrJsonparseNeedSubItem    = errors.New("Pipe type jsonparse need one subItem")
-	ErrArrayNeedSubItem        = errors.New("Pipe type array need one subItem")
-	ErrNotSupportPipeType      = errors.New("Not support pipe type")
-	ErrUnknowHTMLAttr          = errors.New("Unknow html attr")
-	ErrUnsupportText2boolType  = errors.New("Unsupport text2bool type")
-	ErrUnsupportText2floatType = errors.New("Unsupport text2float type")
-	ErrUnsupportText2intType   = errors.New("Unsupport text2int type")
-	ErrTrimNilParams           = errors.New("Filter trim nil params")
-	ErrSplitNilParams          = errors.New("Filter split nil params")
-	ErrJoinNilParams           = errors.New("Filter join nil params")
-	ErrFetcherNotRegistered    = errors.New("Fetcher not registered")
-	ErrStorerNotRegistered     = errors.New("Storer not registered")
-	ErrInvalidContent          = errors.New("Invalid content")
+	ErrJsonparseNeedSubItem       = errors.New("Pipe type jsonparse need one subItem")
+	ErrArrayNeedSubItem           = errors.New("Pipe type array need one subItem")
+	ErrCoalesceNeedSubItem        = errors.New("Pipe type coalesce need subItem")
+	ErrNotSupportPipeType         = errors.New("Not support pipe type")
+	ErrUnknowHTMLAttr             = errors.New("Unknow html attr")
+	ErrUnsupportText2boolType     = errors.New("Unsupport text2bool type")
+	ErrUnsupportText2floatType    = errors.New("Unsupport text2float type")
+	ErrUnsupportText2intType      = errors.New("Unsupport text2int type")
+	ErrUnsupportText2datetimeType = errors.New("Unsupport text2datetime type")
+	ErrTrimNilParams              = errors.New("Filter trim nil params")
+	ErrSplitNilParams             = errors.New("Filter split nil params")
+	ErrJoinNilParams              = errors.New("Filter join nil params")
+	ErrFetcherNotRegistered       = errors.New("Fetcher not registered")
+	ErrStorerNotRegistered        = errors.New("Storer not registered")
+	ErrInvalidContent             = errors.New("Invalid content")
+	ErrLimitExceeded              = errors.New("Execution limit exceeded")
+	ErrInvalidNumber              = errors.New("Invalid number")
+	ErrNotMap                     = errors.New("Value is not map")
+	ErrTableNotFound              = errors.New("Pipe type table can't find table node")
+	ErrRefNotFound                = errors.New("Referenced value not found")
+	ErrCircularRef                = errors.New("Circular reference among subItems")
 )
+
+// RegexpTimeoutError regexp2 正则匹配超时
+type RegexpTimeoutError struct {
+	Pattern string
+	Timeout time.Duration
+}
+
+func (e *RegexpTimeoutError) Error() string {
+	return fmt.Sprintf("Regexp match timeout after %v: %s", e.Timeout, e.Pattern)
+}
+
+// IsRegexpTimeout 是否为正则匹配超时错误
+func IsRegexpTimeout(err error) bool {
+	var e *RegexpTimeoutError
+	return errors.As(err, &e)
+}
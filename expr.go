@@ -0,0 +1,765 @@
+package gopiper
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxExprDepth 表达式的最大嵌套层数
+var MaxExprDepth = 64
+
+// exprDeniedFilters 表达式中禁止调用的过滤器(会访问网络或写文件)。通过 each、coalesce 等过滤器间接调用时也会被禁止
+var exprDeniedFilters = map[string]bool{
+	`fetch`:      true,
+	`saveto`:     true,
+	`rewriteurl`: true,
+}
+
+// exprFunctions 表达式的内置函数。同名时优先于过滤器
+var exprFunctions = map[string]func(args []interface{}) (interface{}, error){
+	`len`: func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(`len`, args, 1, 1); err != nil {
+			return nil, err
+		}
+		switch v := args[0].(type) {
+		case nil:
+			return int64(0), nil
+		case string:
+			return int64(utf8.RuneCountInString(v)), nil
+		}
+		n, err := count(nil, args[0], ``)
+		return int64(n.(int)), err
+	},
+	`lower`: exprStringFunc(`lower`, strings.ToLower),
+	`upper`: exprStringFunc(`upper`, strings.ToUpper),
+	`trim`:  exprStringFunc(`trim`, strings.TrimSpace),
+	`str`: func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(`str`, args, 1, 1); err != nil {
+			return nil, err
+		}
+		return exprString(args[0]), nil
+	},
+	`int`: func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(`int`, args, 1, 1); err != nil {
+			return nil, err
+		}
+		n, err := exprNumber(args[0])
+		return int64(n), err
+	},
+	`float`: func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(`float`, args, 1, 1); err != nil {
+			return nil, err
+		}
+		return exprNumber(args[0])
+	},
+	`contains`: func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(`contains`, args, 2, 2); err != nil {
+			return nil, err
+		}
+		if items, ok := toInterfaceSlice(args[0]); ok {
+			for _, item := range items {
+				if exprEqual(item, args[1]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return strings.Contains(exprString(args[0]), exprString(args[1])), nil
+	},
+	`startswith`: func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(`startswith`, args, 2, 2); err != nil {
+			return nil, err
+		}
+		return strings.HasPrefix(exprString(args[0]), exprString(args[1])), nil
+	},
+	`endswith`: func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(`endswith`, args, 2, 2); err != nil {
+			return nil, err
+		}
+		return strings.HasSuffix(exprString(args[0]), exprString(args[1])), nil
+	},
+	`replace`: func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(`replace`, args, 3, 3); err != nil {
+			return nil, err
+		}
+		return strings.Replace(exprString(args[0]), exprString(args[1]), exprString(args[2]), -1), nil
+	},
+	`round`: func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(`round`, args, 1, 2); err != nil {
+			return nil, err
+		}
+		n, err := exprNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		var places float64
+		if len(args) == 2 {
+			if places, err = exprNumber(args[1]); err != nil {
+				return nil, err
+			}
+		}
+		pow := math.Pow10(int(places))
+		return numberResult(math.Round(n*pow) / pow), nil
+	},
+	`floor`: exprMathFunc(`floor`, math.Floor),
+	`ceil`:  exprMathFunc(`ceil`, math.Ceil),
+	`abs`:   exprMathFunc(`abs`, math.Abs),
+	`concat`: func(args []interface{}) (interface{}, error) {
+		b := strings.Builder{}
+		for _, arg := range args {
+			b.WriteString(exprString(arg))
+		}
+		return b.String(), nil
+	},
+}
+
+func exprArgs(name string, args []interface{}, min int, max int) error {
+	if len(args) < min || len(args) > max {
+		return fmt.Errorf("Expr function %s: invalid number of arguments", name)
+	}
+	return nil
+}
+
+func exprStringFunc(name string, fn func(string) string) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(name, args, 1, 1); err != nil {
+			return nil, err
+		}
+		return fn(exprString(args[0])), nil
+	}
+}
+
+func exprMathFunc(name string, fn func(float64) float64) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if err := exprArgs(name, args, 1, 1); err != nil {
+			return nil, err
+		}
+		n, err := exprNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return numberResult(fn(n)), nil
+	}
+}
+
+func exprString(v interface{}) string {
+	switch vt := v.(type) {
+	case nil:
+		return ``
+	case string:
+		return vt
+	case float64:
+		return strconv.FormatFloat(vt, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func exprNumber(v interface{}) (float64, error) {
+	if v == nil {
+		return 0, nil
+	}
+	if b, ok := v.(bool); ok {
+		if b {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	n, ok := valueNumber(v)
+	if !ok {
+		return 0, fmt.Errorf("Expr: %q is not a number", exprString(v))
+	}
+	return n, nil
+}
+
+func exprEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if ba, ok := a.(bool); ok {
+		bb, ok := b.(bool)
+		return ok && ba == bb
+	}
+	return compareValues(a, b) == 0
+}
+
+// exprEnv 表达式的执行环境
+type exprEnv struct {
+	pipe  *PipeItem
+	value interface{} // 当前值，在表达式中用 value 或 $ 引用
+	scope *valueScope // 已提取的同级字段，上一级map的字段用 parent 引用
+}
+
+func (e *exprEnv) lookup(name string) interface{} {
+	if name == `value` || name == `$` {
+		return e.value
+	}
+	if e.scope != nil {
+		if v, ok := e.scope.values[name]; ok {
+			return v
+		}
+		if name == `parent` && e.scope.parent != nil {
+			return e.scope.parent.values
+		}
+	}
+	if m, ok := toMap(e.value); ok {
+		return m[name]
+	}
+	return nil
+}
+
+func (e *exprEnv) call(name string, args []interface{}) (interface{}, error) {
+	if fn, ok := exprFunctions[name]; ok {
+		return fn(args)
+	}
+	if _, ok := filters[name]; !ok {
+		return nil, fmt.Errorf("Expr: function %s not found", name)
+	}
+	// 调用过滤器：第一个参数为值，其余参数用逗号连接后作为过滤器参数
+	var src interface{}
+	params := make([]string, 0, len(args))
+	if len(args) > 0 {
+		src = args[0]
+		for _, arg := range args[1:] {
+			params = append(params, exprString(arg))
+		}
+	}
+	return applyFilter(e.pipe, name, src, strings.Join(params, `,`))
+}
+
+type exprFunc func(env *exprEnv) (interface{}, error)
+
+type exprToken struct {
+	kind  byte // n:数值 s:字符串 i:标识符 o:运算符 e:结束
+	text  string
+	value interface{}
+	pos   int
+}
+
+func exprTokenize(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9' || (r == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("Expr: invalid number %q at %d", src[start:i], start)
+			}
+			tokens = append(tokens, exprToken{kind: 'n', text: src[start:i], value: n, pos: start})
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			b := strings.Builder{}
+			closed := false
+			for i < len(src) {
+				c := src[i]
+				if c == byte(r) {
+					closed = true
+					i++
+					break
+				}
+				if c == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(src[i])
+					}
+					i++
+					continue
+				}
+				b.WriteByte(c)
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("Expr: unterminated string at %d", start)
+			}
+			tokens = append(tokens, exprToken{kind: 's', text: src[start:i], value: b.String(), pos: start})
+		case r == '_' || r == '$' || unicode.IsLetter(r):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if r != '_' && r != '$' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, exprToken{kind: 'i', text: src[start:i], pos: start})
+		default:
+			op := ``
+			for _, candidate := range []string{`==`, `!=`, `<=`, `>=`, `&&`, `||`, `+`, `-`, `*`, `/`, `%`, `<`, `>`, `!`, `?`, `:`, `(`, `)`, `[`, `]`, `.`, `,`} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if len(op) == 0 {
+				return nil, fmt.Errorf("Expr: unexpected character %q at %d", r, i)
+			}
+			tokens = append(tokens, exprToken{kind: 'o', text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: 'e', pos: len(src)}), nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	depth  int
+}
+
+// compileExpr 编译表达式
+func compileExpr(src string) (exprFunc, error) {
+	tokens, err := exprTokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	fn, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != 'e' {
+		return nil, fmt.Errorf("Expr: unexpected %q at %d", tok.text, tok.pos)
+	}
+	return fn, nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != 'e' {
+		p.pos++
+	}
+	return tok
+}
+
+// isOp 当前标记是否为指定的运算符(and/or/not 分别等同于 &&、||、!)
+func (p *exprParser) isOp(ops ...string) (string, bool) {
+	tok := p.peek()
+	text := tok.text
+	if tok.kind == 'i' {
+		switch text {
+		case `and`:
+			text = `&&`
+		case `or`:
+			text = `||`
+		case `not`:
+			text = `!`
+		default:
+			return ``, false
+		}
+	} else if tok.kind != 'o' {
+		return ``, false
+	}
+	for _, op := range ops {
+		if text == op {
+			return op, true
+		}
+	}
+	return ``, false
+}
+
+func (p *exprParser) expect(op string) error {
+	tok := p.next()
+	if tok.kind != 'o' || tok.text != op {
+		return fmt.Errorf("Expr: expected %q at %d", op, tok.pos)
+	}
+	return nil
+}
+
+func (p *exprParser) enter() error {
+	p.depth++
+	if p.depth > MaxExprDepth {
+		return errors.New("Expr: nesting too deep")
+	}
+	return nil
+}
+
+func (p *exprParser) parseTernary() (exprFunc, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.isOp(`?`); !ok {
+		return cond, nil
+	}
+	p.next()
+	then, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(`:`); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return func(env *exprEnv) (interface{}, error) {
+		v, err := cond(env)
+		if err != nil {
+			return nil, err
+		}
+		if isTruthy(v) {
+			return then(env)
+		}
+		return otherwise(env)
+	}, nil
+}
+
+// 二元运算符的优先级(从低到高)
+var exprBinaryOps = [][]string{
+	{`||`},
+	{`&&`},
+	{`==`, `!=`},
+	{`<`, `<=`, `>`, `>=`},
+	{`+`, `-`},
+	{`*`, `/`, `%`},
+}
+
+func (p *exprParser) parseBinary(level int) (exprFunc, error) {
+	if level >= len(exprBinaryOps) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.isOp(exprBinaryOps[level]...)
+		if !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary(op, left, right)
+	}
+}
+
+func exprBinary(op string, left, right exprFunc) exprFunc {
+	return func(env *exprEnv) (interface{}, error) {
+		a, err := left(env)
+		if err != nil {
+			return nil, err
+		}
+		switch op { // 短路求值
+		case `&&`:
+			if !isTruthy(a) {
+				return false, nil
+			}
+			b, err := right(env)
+			return isTruthy(b), err
+		case `||`:
+			if isTruthy(a) {
+				return true, nil
+			}
+			b, err := right(env)
+			return isTruthy(b), err
+		}
+		b, err := right(env)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case `==`:
+			return exprEqual(a, b), nil
+		case `!=`:
+			return !exprEqual(a, b), nil
+		case `<`:
+			return compareValues(a, b) < 0, nil
+		case `<=`:
+			return compareValues(a, b) <= 0, nil
+		case `>`:
+			return compareValues(a, b) > 0, nil
+		case `>=`:
+			return compareValues(a, b) >= 0, nil
+		case `+`:
+			_, isStringA := a.(string)
+			_, isStringB := b.(string)
+			if isStringA || isStringB { // 有字符串时拼接字符串
+				return exprString(a) + exprString(b), nil
+			}
+		}
+		x, err := exprNumber(a)
+		if err != nil {
+			return nil, err
+		}
+		y, err := exprNumber(b)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case `+`:
+			return numberResult(x + y), nil
+		case `-`:
+			return numberResult(x - y), nil
+		case `*`:
+			return numberResult(x * y), nil
+		case `/`:
+			if y == 0 {
+				return nil, errors.New("Expr: division by zero")
+			}
+			return numberResult(x / y), nil
+		case `%`:
+			if y == 0 {
+				return nil, errors.New("Expr: division by zero")
+			}
+			return numberResult(math.Mod(x, y)), nil
+		}
+		return nil, fmt.Errorf("Expr: unsupported operator %s", op)
+	}
+}
+
+func (p *exprParser) parseUnary() (exprFunc, error) {
+	op, ok := p.isOp(`!`, `-`)
+	if !ok {
+		return p.parsePostfix()
+	}
+	p.next()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if op == `!` {
+		return func(env *exprEnv) (interface{}, error) {
+			v, err := operand(env)
+			return !isTruthy(v), err
+		}, nil
+	}
+	return func(env *exprEnv) (interface{}, error) {
+		v, err := operand(env)
+		if err != nil {
+			return nil, err
+		}
+		n, err := exprNumber(v)
+		return numberResult(-n), err
+	}, nil
+}
+
+func (p *exprParser) parsePostfix() (exprFunc, error) {
+	fn, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.isOp(`.`); ok {
+			p.next()
+			tok := p.next()
+			if tok.kind != 'i' && tok.kind != 'n' {
+				return nil, fmt.Errorf("Expr: expected field name at %d", tok.pos)
+			}
+			fn = exprIndex(fn, exprConst(tok.text))
+			continue
+		}
+		if _, ok := p.isOp(`[`); ok {
+			p.next()
+			index, err := p.parseTernary()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(`]`); err != nil {
+				return nil, err
+			}
+			fn = exprIndex(fn, index)
+			continue
+		}
+		return fn, nil
+	}
+}
+
+func exprConst(v interface{}) exprFunc {
+	return func(env *exprEnv) (interface{}, error) {
+		return v, nil
+	}
+}
+
+func exprIndex(target, index exprFunc) exprFunc {
+	return func(env *exprEnv) (interface{}, error) {
+		v, err := target(env)
+		if err != nil {
+			return nil, err
+		}
+		key, err := index(env)
+		if err != nil {
+			return nil, err
+		}
+		res, _ := GetPath(v, `[`+exprString(key)+`]`)
+		if m, ok := toMap(v); ok { // 键名中可能有“.”
+			res = m[exprString(key)]
+		}
+		return res, nil
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprFunc, error) {
+	tok := p.next()
+	switch tok.kind {
+	case 'n', 's':
+		return exprConst(tok.value), nil
+	case 'i':
+		switch tok.text {
+		case `true`:
+			return exprConst(true), nil
+		case `false`:
+			return exprConst(false), nil
+		case `null`, `nil`:
+			return exprConst(nil), nil
+		}
+		if _, ok := p.isOp(`(`); ok {
+			return p.parseCall(tok.text)
+		}
+		name := tok.text
+		return func(env *exprEnv) (interface{}, error) {
+			return env.lookup(name), nil
+		}, nil
+	case 'o':
+		switch tok.text {
+		case `(`:
+			fn, err := p.parseTernary()
+			if err != nil {
+				return nil, err
+			}
+			return fn, p.expect(`)`)
+		case `[`:
+			items, err := p.parseList(`]`)
+			if err != nil {
+				return nil, err
+			}
+			return func(env *exprEnv) (interface{}, error) {
+				return exprEvalList(env, items)
+			}, nil
+		}
+	case 'e':
+		return nil, errors.New("Expr: unexpected end of expression")
+	}
+	return nil, fmt.Errorf("Expr: unexpected %q at %d", tok.text, tok.pos)
+}
+
+func (p *exprParser) parseList(end string) ([]exprFunc, error) {
+	var items []exprFunc
+	if _, ok := p.isOp(end); ok {
+		p.next()
+		return items, nil
+	}
+	for {
+		item, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if _, ok := p.isOp(`,`); ok {
+			p.next()
+			continue
+		}
+		return items, p.expect(end)
+	}
+}
+
+func exprEvalList(env *exprEnv, items []exprFunc) ([]interface{}, error) {
+	res := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		v, err := item(env)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+func (p *exprParser) parseCall(name string) (exprFunc, error) {
+	p.next() // (
+	args, err := p.parseList(`)`)
+	if err != nil {
+		return nil, err
+	}
+	return func(env *exprEnv) (interface{}, error) {
+		values, err := exprEvalList(env, args)
+		if err != nil {
+			return nil, err
+		}
+		return env.call(name, values)
+	}, nil
+}
+
+// EvalExpr 执行表达式。value 为当前值(在表达式中用 value 或 $ 引用，为map时也可以直接引用其中的字段)，scope 为可引用的其它字段
+func (p *PipeItem) EvalExpr(expression string, value interface{}, scope map[string]interface{}) (interface{}, error) {
+	return p.evalExpr(expression, value, &valueScope{values: scope})
+}
+
+func (p *PipeItem) evalExpr(expression string, value interface{}, scope *valueScope) (interface{}, error) {
+	fn, err := compileExpr(expression)
+	if err != nil {
+		return nil, err
+	}
+	sandbox := *p
+	sandbox.sandboxed = true
+	return fn(&exprEnv{pipe: &sandbox, value: value, scope: scope})
+}
+
+// exprIdentifiers 返回表达式中引用的字段名(不包括函数名和下标中的字段名)
+func exprIdentifiers(expression string) []string {
+	tokens, err := exprTokenize(expression)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for i, tok := range tokens {
+		if tok.kind != 'i' {
+			continue
+		}
+		if i > 0 && tokens[i-1].kind == 'o' && tokens[i-1].text == `.` {
+			continue
+		}
+		if next := tokens[i+1]; next.kind == 'o' && next.text == `(` {
+			continue
+		}
+		names = append(names, tok.text)
+	}
+	return names
+}
+
+// expr(price * qty) => src={"price":2,"qty":3} => 6
+// expr(value + " - " + brand) => src="title" => "title - brand"(brand 为已提取的同级字段)
+func exprFilter(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return pipe.evalExpr(params, src, pipe.scope)
+}
+
+// pipeExpr 执行 expr 类型的规则：selector 为表达式，可以引用已提取的同级字段及上级map的字段(parent.field)
+func (p *PipeItem) pipeExpr() (interface{}, error) {
+	v, err := p.evalExpr(p.Selector, nil, p.scope)
+	if err != nil {
+		return nil, err
+	}
+	return callFilter(p, v, p.Filter)
+}
@@ -0,0 +1,80 @@
+package gopiper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalExpr(t *testing.T) {
+	p := &PipeItem{}
+	scope := map[string]interface{}{`price`: `12.50`, `qty`: 3, `title`: `Phone`, `brand`: `ACME`, `tags`: []interface{}{`a`, `b`}}
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`price * qty`, 37.5},
+		{`1 + 2 * 3 - 4 / 2`, int64(5)},
+		{`(1 + 2) * 3 % 4`, int64(1)},
+		{`-qty + 1`, int64(-2)},
+		{`title + " - " + brand`, `Phone - ACME`},
+		{`'数量:' + qty`, `数量:3`},
+		{`qty > 2 && price < 20`, true},
+		{`not (qty >= 3) or false`, false},
+		{`qty == 3 ? "many" : "few"`, `many`},
+		{`missing == null`, true},
+		{`tags[1] + tags[-2]`, `ba`},
+		{`len(tags) + len(title)`, int64(7)},
+		{`upper(brand) == "ACME" && contains(tags, "b")`, true},
+		{`round(price * 1.111, 2)`, 13.89},
+		{`replace(title, "Ph", "f")`, `fone`},
+		{`substr(title, 0, 2)`, `Ph`},
+		{`[1, "a", qty][2]`, 3},
+	}
+	for _, test := range tests {
+		r, e := p.EvalExpr(test.expr, nil, scope)
+		if assert.NoError(t, e, test.expr) {
+			assert.Equal(t, test.expected, r, test.expr)
+		}
+	}
+
+	for _, expr := range []string{`1 +`, `(1`, `"abc`, `1 / 0`, `fetch("http://example.com")`, `nofunc(1)`, `1 # 2`} {
+		_, e := p.EvalExpr(expr, nil, scope)
+		assert.Error(t, e, expr)
+	}
+	_, e := p.EvalExpr(strings.Repeat(`(`, 100)+`1`+strings.Repeat(`)`, 100), nil, nil)
+	assert.Error(t, e)
+
+	var fetched []string
+	p.SetFetcher(func(url string) ([]byte, error) {
+		fetched = append(fetched, url)
+		return []byte(`internal`), nil
+	})
+	for _, expr := range []string{`each("http://internal/", "fetch(text)")`, `coalesce("http://internal/", "fetch(text)")`, `if("http://internal/", "exists", "saveto(/tmp)")`} {
+		p.EvalExpr(expr, nil, scope)
+	}
+	assert.Empty(t, fetched)
+	p.SetFetcher(nil)
+
+	r, e := p.CallFilter(map[string]interface{}{`a`: 2, `b`: 5}, `expr(a * b)`)
+	assert.NoError(t, e)
+	assert.Equal(t, int64(10), r)
+	r, e = p.CallFilter(`abc`, `expr(value + "|" + upper($))`)
+	assert.NoError(t, e)
+	assert.Equal(t, `abc|ABC`, r)
+
+	body := []byte(`<div><span class="price">2.5</span><span class="qty">4</span><h1>Phone</h1></div>`)
+	item := PipeItem{
+		Type: PT_MAP,
+		SubItem: []PipeItem{
+			{Name: `price`, Selector: `.price`, Type: PT_FLOAT},
+			{Name: `qty`, Selector: `.qty`, Type: PT_INT},
+			{Name: `total`, Selector: `price * qty`, Type: PT_EXPR},
+			{Name: `title`, Selector: `h1`, Type: PT_TEXT, Filter: `expr(value + " x" + qty)`},
+		},
+	}
+	r, e = item.PipeBytes(body, `html`)
+	assert.NoError(t, e)
+	assert.Equal(t, map[string]interface{}{`price`: 2.5, `qty`: int64(4), `total`: int64(10), `title`: `Phone x4`}, r)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"html"
+	neturl "net/url"
 	"path"
 	"reflect"
 	"regexp"
@@ -26,25 +27,87 @@ func init() {
 	RegisterFilter("trimright", trimright, "从右边剪掉指定字符串", `trimright(.html)`, ``)
 	RegisterFilter("trimspace", trimspace, "剪掉头尾空白", `trimspace`, ``)
 	RegisterFilter("substr", substr, "获取子字符串。字符串总是从左向右从0开始编号，参数1和参数2分别用来指定要截取的起止位置编号，截取子字符串时，总是包含起始编号的字符，不包含终止编号的字符", `substr(0,5)`, ``)
-	RegisterFilter("intval", intval, "转换为整数", `intval`, ``)
-	RegisterFilter("floatval", floatval, "转换为小数", `floatval`, ``)
+	RegisterFilter("intval", intval, "转换为整数(小数部分会被舍去)。支持货币符号、千位分隔符、中文数字以及万/亿/k/M等数量级后缀。参数为地区(例如de、fr)，用于确定千位分隔符和小数点，不指定时自动识别", `intval(en)`, `intval、intval(de)`)
+	RegisterFilter("floatval", floatval, "转换为小数。支持货币符号、千位分隔符、中文数字以及万/亿/k/M等数量级后缀。参数为地区(例如de、fr)，用于确定千位分隔符和小数点，不指定时自动识别", `floatval(en)`, `floatval、floatval(fr)`)
 	RegisterFilter("hrefreplace", hrefreplace, "替换href属性。$2为捕获到的href属性值", `hrefreplace(data-url="$2")`, ``)
 	RegisterFilter("regexpreplace", regexpreplace, "正则替换(regexp2引擎)。参数1为正则表达式，参数2为替换成的新内容，参数3为起始位置编号(从0开始)，参数4为替换次数(-1代表相对全部替换,-2代表绝对全部替换)", `regexpreplace(^A$,B,0,-1)`, ``)
 	RegisterFilter("wraphtml", wraphtml, "将采集到的数据用HTML标签包围起来", `wraphtml(a)`, ``)
 	RegisterFilter("tosbc", tosbc, "将全角的标点符号和英文字母转换为半角", `tosbc`, ``)
+	RegisterFilter("s2t", s2t, "简体中文转为繁体中文", `s2t`, ``)
+	RegisterFilter("t2s", t2s, "繁体中文转为简体中文", `t2s`, ``)
+	RegisterFilter("pinyin", pinyin, "将汉字转为拼音(非汉字的部分原样保留)。参数1为风格：tone(带声调符号，默认)、number(声调用数字表示)、normal(不带声调)、first(首字母)，参数2为分隔符(默认为空格，first风格默认不分隔)", `pinyin(style,separator)`, `pinyin、pinyin(normal,-)、pinyin(first)`)
+	RegisterFilter("cn2num", cn2num, "将中文数字转为数值，例如“二千三百”转为2300。参数为text时转换文本中所有的中文数字", `cn2num`, `cn2num、cn2num(text)`)
+	RegisterFilter("num2cn", num2cn, "将数字转为中文数字，例如2300转为“二千三百”。参数upper代表使用大写数字(贰仟叁佰)，参数text代表转换文本中所有的数字", `num2cn(upper,text)`, `num2cn、num2cn(upper)、num2cn(text)`)
 	RegisterFilter("unescape", unescape, "解码HTML", `unescape`, ``)
 	RegisterFilter("escape", escape, "编码HTML", `escape`, ``)
+	RegisterFilter("md5", md5Filter, "计算MD5摘要(十六进制)", `md5`, ``)
+	RegisterFilter("sha1", sha1Filter, "计算SHA1摘要(十六进制)", `sha1`, ``)
+	RegisterFilter("sha256", sha256Filter, "计算SHA256摘要(十六进制)", `sha256`, ``)
+	RegisterFilter("hmac", hmacFilter, "计算HMAC摘要(十六进制)。参数1为密钥，参数2为哈希算法(md5、sha1、sha256、sha512，默认为sha256)", `hmac(key,sha256)`, `hmac(secret)、hmac(secret,sha1)`)
+	RegisterFilter("base64encode", base64encode, "Base64编码。参数为url时使用URL安全的字符集", `base64encode`, `base64encode、base64encode(url)`)
+	RegisterFilter("base64decode", base64decode, "Base64解码(自动识别标准字符集和URL安全字符集)", `base64decode`, ``)
+	RegisterFilter("urlencode", urlencode, "网址编码。参数为path时按网址路径编码(空格编码为%20)", `urlencode`, `urlencode、urlencode(path)`)
+	RegisterFilter("urldecode", urldecode, "网址解码。参数为path时不将“+”解码为空格", `urldecode`, `urldecode、urldecode(path)`)
+	RegisterFilter("hex", hexFilter, "转为十六进制字符串", `hex`, ``)
+	RegisterFilter("crc32", crc32Filter, "计算CRC32校验值(十六进制)", `crc32`, ``)
+	RegisterFilter("uuid5", uuid5, "根据值生成固定的UUID(第5版)。参数为命名空间：dns、url、oid、x500 或UUID，其它字符串会先转为UUID，默认为url", `uuid5(namespace)`, `uuid5、uuid5(dns)、uuid5(mysite)`)
+	RegisterFilter("urlparse", urlparse, "解析网址，返回 {\"scheme\",\"host\",\"hostname\",\"port\",\"path\",\"query\",\"rawquery\",\"fragment\"}。参数出现多次时query中的值为数组", `urlparse`, ``)
+	RegisterFilter("queryget", queryget, "获取网址中指定查询参数的值", `queryget(name)`, `queryget(id)`)
+	RegisterFilter("queryset", queryset, "设置网址中查询参数的值(不存在时添加)", `queryset(name,value)`, `queryset(page,2)`)
+	RegisterFilter("querydel", querydel, "删除网址中的查询参数。参数名支持通配符(*、?)", `querydel(name1,name2)`, `querydel(utm_*,fbclid)`)
+	RegisterFilter("urlnormalize", urlnormalize, "规范化网址：协议和域名转为小写，删除默认端口、片段(#)和路径中的“.”和“..”，按参数名排序查询参数", `urlnormalize`, ``)
+	RegisterFilter("urljoin", urljoin, "将相对网址转为绝对网址", `urljoin(base)`, `urljoin(https://www.admpub.com/news/)`)
+	RegisterFilter("iconv", iconv, "转换字符编码(编码名称支持gbk、gb18030、big5、latin1等)。参数1为原编码，参数2为目标编码。用于修复乱码时可以组合使用", `iconv(from,to)`, `iconv(gbk,utf-8)、iconv(utf-8,latin1)|iconv(gbk,utf-8)`)
 	RegisterFilter("sprintf", sprintf, "格式化", `sprintf(%s)`, ``)
 	RegisterFilter("sprintfmap", sprintfmap, "用map值格式化(前提是采集到的数据必须是map类型)。参数1为模板字符串，其它参数用于指定相应map元素值的键值", `sprintfmap(%v-%v,a,b)`, ``)
 	RegisterFilter("unixtime", unixtime, "UNIX时间戳(秒)。如果带参数则代表将获取到的数据按照参数指定的格式转为时间戳；不带参数则获取当前时间戳", `unixtime(DateTime)`, `unixtime、unixtime(Y-m-d H:i:s)、unixtime(DateTime) 或 unixtime(2006-01-02 15:04:05)`)
+	RegisterFilter("datetime", datetime, "解析日期时间。支持多种常见格式、相对时间(例如“3 小时前”、“昨天 14:20”、“2 days ago”)和中文日期(例如“2024年5月3日”)。参数1为输出格式(rfc3339、unix、unixmill或日期格式，默认为rfc3339)，参数2为时区(例如Asia/Shanghai或+08:00，默认为本地时区)，参数3为优先尝试的日期格式(多个格式用分号分隔)", `datetime(rfc3339,Asia/Shanghai,Y-m-d H:i)`, `datetime、datetime(unix)、datetime(Y-m-d H:i:s,+08:00) 或 datetime(unixmill,UTC,02/01/2006;02.01.2006)`)
 	RegisterFilter("unixmill", unixmill, "获取当前UNIX时间戳(毫秒)", `unixmill`, ``)
 	RegisterFilter("paging", paging, "分页。参数1为起始页码，参数2为终止页码，参数3为步进值(可选)。需要在网址中添加页码占位符“{0}”，一般与sprintf组合起来使用。经过paging处理后的网址会变成网址数组", `paging(1,10,1)`, `sprintf(%s?page={0})|paging(1,10)`)
 	RegisterFilter("quote", quote, "用双引号包起来", `quote`, ``)
 	RegisterFilter("unquote", unquote, "取消双引号包围", `unquote`, ``)
 	RegisterFilter("saveto", saveto, "下载并保存文件到指定位置", `saveto(savePath)`, ``)
-	RegisterFilter("fetch", fetch, "抓取网址内容。参数pageType仅支持html、json、text这三个值", `fetch(pageType,selector)`, ``)
+	RegisterFilter("fetch", fetch, "抓取网址内容。参数pageType仅支持html、json、text这三个值；参数charset为页面编码，不指定时如果启用了编码转换(SetCharset)则自动识别每个页面的编码", `fetch(pageType,selector,charset)`, ``)
 	RegisterFilter("basename", basename, "获取文件名", `basename`, ``)
 	RegisterFilter("extension", extension, "获取扩展名", `extension`, ``)
+	RegisterFilter("markdown", markdown, "将HTML转换为Markdown", `markdown`, ``)
+	RegisterFilter("plaintext", plaintext, "将HTML转换为纯文本(删除script和style，块级元素之间换行)", `plaintext`, ``)
+	RegisterFilter("rewriteurl", rewriteurl, "改写HTML中的资源网址(img/source/video/audio的src、srcset和延迟加载属性data-src等，以及a标签的href)。参数1为基础网址(用于转为绝对网址)，参数2和参数3与saveto相同(指定时会下载资源文件并替换为保存后的路径)", `rewriteurl(baseURL,savePath)`, `rewriteurl(https://www.admpub.com/news/)`)
+	RegisterFilter("unique", unique, "数组去重", `unique`, ``)
+	RegisterFilter("sort", sortArray, "数组排序。参数可以为asc(升序，默认)、desc(降序)、numeric(按数值排序，不是数值的元素排在最后)，可组合使用", `sort(numeric,desc)`, `sort、sort(desc)、sort(numeric)`)
+	RegisterFilter("slice", slice, "截取数组。参数1和参数2分别为起止位置编号(从0开始，不包含终止编号的元素)，负数代表从末尾开始计算，参数2可省略", `slice(0,5)`, `slice(1)、slice(-3)、slice(0,-1)`)
+	RegisterFilter("compact", compact, "删除数组中的空元素(null、空字符串、空数组和空map)", `compact`, ``)
+	RegisterFilter("flatten", flatten, "将多维数组展开为一维数组", `flatten`, ``)
+	RegisterFilter("first", first, "获取数组的第一个元素", `first`, ``)
+	RegisterFilter("last", last, "获取数组的最后一个元素", `last`, ``)
+	RegisterFilter("count", count, "获取数组或map的元素个数", `count`, ``)
+	RegisterFilter("reverse", reverse, "反转数组", `reverse`, ``)
+	RegisterFilter("chunk", chunk, "将数组按指定大小分割成多个数组", `chunk(2)`, ``)
+	RegisterFilter("pick", pick, "只保留map中指定的键(数组中的每个map都会处理)", `pick(a,b)`, ``)
+	RegisterFilter("omit", omit, "删除map中指定的键(数组中的每个map都会处理)", `omit(a,b)`, ``)
+	RegisterFilter("rename", rename, "重命名map的键。参数格式为“旧键名:新键名”(数组中的每个map都会处理)", `rename(old:new)`, `rename(title:name,link:url)`)
+	RegisterFilter("merge", merge, "合并map。值为map数组时合并为一个map；参数为JSON对象时合并到map中；参数为键名时将对应的子map合并到上一级", `merge`, `merge、merge(info)、merge({"source":"web"})`)
+	RegisterFilter("get", mapGet, "按路径获取map或数组中的值", `get(path)`, `get(a.b[0].c)`)
+	RegisterFilter("set", mapSet, "按路径设置map中的值。值为JSON格式时按JSON解析，否则作为字符串", `set(path,value)`, `set(a.b,1)、set(tags,["a","b"])`)
+	RegisterFilter("keys", mapKeys, "获取map的键(按字母顺序排序)", `keys`, ``)
+	RegisterFilter("values", mapValues, "获取map的值(按键的字母顺序排序)", `values`, ``)
+	RegisterFilter("entries", mapEntries, "将map转为 {\"key\":键,\"value\":值} 数组(按键的字母顺序排序)", `entries`, ``)
+	RegisterFilter("fromentries", fromentries, "将 {\"key\":键,\"value\":值} 或 [键,值] 数组转为map", `fromentries`, ``)
+	RegisterFilter("each", each, "对数组中的每个元素(或map中的每个值)执行过滤器链(参数中的过滤器用“|”分隔)", `each(trimspace|substr(0,5))`, ``)
+	RegisterFilter("where", where, "只保留数组中符合条件的元素。条件格式为“字段 运算符 值”，运算符支持 ==、!=、>、>=、<、<=、~(正则匹配)、!~、contains、startswith、endswith、in、exists、empty，只写字段时判断字段值是否为真，字段为“.”时代表元素本身", `where(price > 100)`, `where(status == on)、where(title ~ ^abc)、where(tags contains go)、where(. >= 10)`)
+	RegisterFilter("reject", reject, "删除数组中符合条件的元素。条件格式与where相同", `reject(price > 100)`, ``)
+	RegisterFilter("groupby", groupby, "按字段值将数组分组为map", `groupby(type)`, ``)
+	RegisterFilter("sum", aggSum, "求和。参数为字段路径，不指定时使用元素本身", `sum(price)`, `sum、sum(price)`)
+	RegisterFilter("min", aggMin, "求最小值。参数为字段路径，不指定时使用元素本身", `min(price)`, `min、min(price)`)
+	RegisterFilter("max", aggMax, "求最大值。参数为字段路径，不指定时使用元素本身", `max(price)`, `max、max(price)`)
+	RegisterFilter("avg", aggAvg, "求平均值。参数为字段路径，不指定时使用元素本身", `avg(price)`, `avg、avg(price)`)
+	RegisterFilter("if", ifFilter, "条件分支。参数1为条件(格式与where相同，省略字段或字段为“.”时代表值本身)，参数2和参数3分别为条件成立和不成立时执行的过滤器链(以“=”开头时代表直接返回“=”后面的值，为空时保持原值)", `if(condition,then,else)`, `if(contains free,=0,floatval)`)
+	RegisterFilter("default", defaultFilter, "值为空(null、空字符串、空数组或空map)时使用参数指定的值(按JSON解析，否则作为字符串)", `default(value)`, `default(0)、default(未知)`)
+	RegisterFilter("coalesce", coalesce, "依次执行各参数指定的过滤器链，返回第一个不为空的结果(以“=”开头的参数代表直接返回“=”后面的值)", `coalesce(get(price),get(sale_price),=0)`, ``)
+	RegisterFilter("switch", switchFilter, "按正则表达式(regexp2引擎)匹配分支。参数格式为“正则表达式=>过滤器链”，最后一个不带“=>”的参数为默认分支", `switch(regexp=>chain,default)`, `switch(^free$=>=0,万$=>floatval,=-1)`)
+	RegisterFilter("js", js, "执行JavaScript脚本并返回最后一个语句的值。脚本中 value 为当前值，$ 为同一map中已提取的字段，parent 为上一级map中的字段。不能访问文件和网络，执行时间和内存受限制", `js(code)`, `js(value.toUpperCase())、js(value * $.qty)`)
+	RegisterFilter("expr", exprFilter, "执行表达式(支持四则运算、字符串拼接、比较、逻辑运算、三元运算和函数调用)。value 或 $ 代表当前值，可以直接引用当前值(map)中的字段和同一map中已提取的字段", `expr(expression)`, `expr(price * qty)、expr(value + " - " + brand)`)
+	RegisterFilter("sanitize", sanitize, "按白名单策略过滤HTML。内置策略：strict(只保留文本)、basic(基本格式，默认)、ugc(用户生成内容，包含链接、图片、列表和表格等)", `sanitize(ugc)`, ``)
 }
 
 type FilterFunction func(pipe *PipeItem, src interface{}, params string) (interface{}, error)
@@ -96,8 +159,14 @@ var (
 )
 
 func applyFilter(pipe *PipeItem, name string, src interface{}, params string) (interface{}, error) {
+	if pipe.sandboxed && exprDeniedFilters[name] {
+		return nil, fmt.Errorf("Filter %s is not allowed in expr", name)
+	}
 	filter, existing := filters[name]
 	if !existing {
+		if code, ok := pipe.scriptFilters()[name]; ok {
+			return pipe.RunScript(code, src, params)
+		}
 		return nil, fmt.Errorf("Filter with name '%s' not found", name)
 	}
 	return filter.function(pipe, src, params)
@@ -105,32 +174,15 @@ func applyFilter(pipe *PipeItem, name string, src interface{}, params string) (i
 
 func callFilter(pipe *PipeItem, src interface{}, value string) (interface{}, error) {
 
-	if src == nil || len(value) == 0 {
+	pipe.node.setValue(src)
+	if len(value) == 0 || (src == nil && !acceptsNil(value)) {
 		return src, nil
 	}
 
-	vt := filterExp.FindAllStringSubmatch(value, -1)
-
-	for _, v := range vt {
-		if len(v) < 3 {
-			continue
-		}
-		name := v[1]
-		params := v[2]
-		next, err := applyFilter(pipe, name, src, params)
-		if err != nil {
-			if err == ErrInvalidContent {
-				return next, err
-			}
-			continue
-		}
-		src = next
-	}
-
-	return src, nil
+	return runFilters(pipe, src, value, false)
 }
 
-// fetch(pageType,selector)
+// fetch(pageType,selector,charset)
 func fetch(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
 	if pipe.fetcher == nil {
 		return src, ErrFetcherNotRegistered
@@ -138,9 +190,13 @@ func fetch(pipe *PipeItem, src interface{}, params string) (interface{}, error)
 	var (
 		pageType = pipe.pageType
 		selector string
+		charset  string
 	)
 	paramList := SplitParams(params, `,`)
 	switch len(paramList) {
+	case 3:
+		charset = strings.TrimSpace(paramList[2])
+		fallthrough
 	case 2:
 		selector = paramList[1]
 		fallthrough
@@ -148,19 +204,27 @@ func fetch(pipe *PipeItem, src interface{}, params string) (interface{}, error)
 		pageType = paramList[0]
 	}
 	return _filterValue(src, func(v string) (interface{}, error) {
+		if err := pipe.countFetch(1); err != nil {
+			return nil, err
+		}
 		body, err := pipe.fetcher(v)
 		if err != nil {
 			return nil, err
 		}
-		if len(selector) == 0 {
-			return string(body), nil
-		}
 		pipe2 := &PipeItem{
 			Name:     ``,
 			Selector: selector,
 			Type:     PT_STRING,
 			Filter:   ``,
 		}
+		pipe2.CopyFrom(pipe)
+		pipe2.charset = pipe.fetchCharset(charset)
+		if len(selector) == 0 {
+			if body, err = pipe2.decodeBody(body, pageType); err != nil {
+				return nil, err
+			}
+			return string(body), nil
+		}
 		return pipe2.PipeBytes(body, pageType)
 	})
 }
@@ -183,10 +247,64 @@ func saveto(pipe *PipeItem, src interface{}, params string) (interface{}, error)
 		savePath = strings.TrimSpace(paramList[0])
 	}
 	return _filterValue(src, func(v string) (interface{}, error) {
+		if err := pipe.countFetch(1); err != nil {
+			return v, err
+		}
 		return pipe.storer(v, savePath, fetched)
 	})
 }
 
+// rewriteurl(baseURL,savePath,fetched)
+func rewriteurl(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	var (
+		base     string
+		savePath string
+		fetched  bool
+	)
+	paramList := SplitParams(params, `,`)
+	switch len(paramList) {
+	case 3:
+		fetched, _ = strconv.ParseBool(strings.TrimSpace(paramList[2]))
+		fallthrough
+	case 2:
+		savePath = strings.TrimSpace(paramList[1])
+		fallthrough
+	case 1:
+		base = strings.TrimSpace(paramList[0])
+	}
+	rewriter := &ResourceRewriter{}
+	if len(base) > 0 {
+		u, err := neturl.Parse(base)
+		if err != nil {
+			return src, err
+		}
+		rewriter.Base = u
+	}
+	var limitErr error
+	if len(savePath) > 0 {
+		if pipe.storer == nil {
+			return src, ErrStorerNotRegistered
+		}
+		rewriter.Store = func(fileURL string) (string, error) {
+			if err := pipe.countFetch(1); err != nil {
+				limitErr = err
+				return ``, err
+			}
+			return pipe.storer(fileURL, savePath, fetched)
+		}
+	}
+	res, err := _filterValue(src, func(v string) (interface{}, error) {
+		return rewriter.Rewrite(v)
+	})
+	for _, e := range rewriter.Errors {
+		pipe.node.addWarning(e)
+	}
+	if limitErr != nil {
+		return src, limitErr
+	}
+	return res, err
+}
+
 // preadd(prefix) => {prefix}{src}
 func preadd(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
 	return _filterValue(src, func(v string) (interface{}, error) {
@@ -315,10 +433,12 @@ func join(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
 	}
 }
 
-// intval => src="123" => 123
+// intval => src="¥1,234" => 1234
+// intval(de) => src="1.234,5" => 1234
 func intval(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
 	return _filterValue(src, func(v string) (interface{}, error) {
-		return strconv.Atoi(v)
+		n, err := ParseInteger(v, params)
+		return int(n), err
 	})
 }
 
@@ -336,10 +456,40 @@ func extension(pipe *PipeItem, src interface{}, params string) (interface{}, err
 	})
 }
 
-// floatval => src="12.3" => 12.3
+// markdown => src="<h1>a</h1>" => "# a"
+func markdown(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return HTMLToMarkdown(v)
+	})
+}
+
+// plaintext => src="<p>a</p><p>b</p>" => "a\n\nb"
+func plaintext(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return HTMLToPlainText(v)
+	})
+}
+
+// sanitize(ugc) => src=`<p onclick="x()">a<script>b</script></p>` => "<p>a</p>"
+func sanitize(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	name := strings.TrimSpace(params)
+	if len(name) == 0 {
+		name = `basic`
+	}
+	policy, ok := GetSanitizePolicy(name)
+	if !ok {
+		return src, fmt.Errorf("Sanitize policy with name '%s' not found", name)
+	}
+	return _filterValue(src, func(v string) (interface{}, error) {
+		return policy.Sanitize(v)
+	})
+}
+
+// floatval => src="3.2万" => 32000
+// floatval(fr) => src="12 345,67" => 12345.67
 func floatval(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
 	return _filterValue(src, func(v string) (interface{}, error) {
-		return strconv.ParseFloat(v, 64)
+		return ParseNumber(v, params)
 	})
 }
 
@@ -374,7 +524,7 @@ func regexpreplace(pipe *PipeItem, src interface{}, params string) (interface{},
 	case 1:
 		expr = vt[0]
 	}
-	re, err := regexp2.Compile(expr, regexp2.RE2)
+	re, err := pipe.compileRegexp2(expr)
 	if err != nil {
 		return src, err
 	}
@@ -384,16 +534,17 @@ func regexpreplace(pipe *PipeItem, src interface{}, params string) (interface{},
 			for find {
 				v, err = re.Replace(v, repl, startAt, -1)
 				if err != nil {
-					return v, err
+					return v, regexp2Error(re, err)
 				}
 				if len(v) == 0 {
 					break
 				}
 				find, err = re.MatchString(v)
 			}
-			return v, err
+			return v, regexp2Error(re, err)
 		}
-		return re.Replace(v, repl, startAt, count)
+		v, err := re.Replace(v, repl, startAt, count)
+		return v, regexp2Error(re, err)
 	})
 }
 
@@ -584,10 +735,28 @@ func paging(pipe *PipeItem, src interface{}, params string) (interface{}, error)
 		}
 	}
 
+	size := 1
+	switch vt := src.(type) {
+	case []interface{}:
+		size = len(vt)
+	case []string:
+		size = len(vt)
+	}
+	count, ok := pagingCount(start, end, size)
+	if !ok {
+		count = maxInt
+	}
+	if err := pipe.checkPaging(count); err != nil {
+		return src, err
+	}
+	if !ok {
+		return src, errors.New("paging range is too large")
+	}
+
 	var result []string
 	switch vt := src.(type) {
 	case []interface{}:
-		for i := start; i <= end; i++ {
+		for i := start; i <= end && i >= start; i++ { // i >= start：end 为最大整数时 i++ 会溢出
 			for _, v := range vt {
 				if offset > 0 {
 					result = append(result, sprintf_replace(com.String(v), []string{strconv.Itoa(i * offset), strconv.Itoa((i + 1) * offset)}))
@@ -599,7 +768,7 @@ func paging(pipe *PipeItem, src interface{}, params string) (interface{}, error)
 		return result, nil
 
 	case []string:
-		for i := start; i <= end; i++ {
+		for i := start; i <= end && i >= start; i++ {
 			for _, v := range vt {
 				if offset > 0 {
 					result = append(result, sprintf_replace(v, []string{strconv.Itoa(i * offset), strconv.Itoa((i + 1) * offset)}))
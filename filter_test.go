@@ -1,11 +1,29 @@
 package gopiper
 
 import (
+	"errors"
+	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// filterTest 过滤器测试用例：src 经过 filter 处理后应得到 expected
+type filterTest struct {
+	src      interface{}
+	filter   string
+	expected interface{}
+}
+
+func runFilterTests(t *testing.T, p *PipeItem, tests []filterTest) {
+	for _, test := range tests {
+		r, e := p.CallFilter(test.src, test.filter)
+		if assert.NoError(t, e, test.filter) {
+			assert.Equal(t, test.expected, r, test.filter)
+		}
+	}
+}
+
 func TestPostAdd(t *testing.T) {
 	p := &PipeItem{}
 	r, e := p.CallFilter(`i`, `postadd(s)`)
@@ -14,3 +32,331 @@ func TestPostAdd(t *testing.T) {
 	}
 	assert.Equal(t, `is`, r)
 }
+
+func TestMarkdown(t *testing.T) {
+	p := &PipeItem{}
+	r, e := p.CallFilter(`<h2>Title</h2>
+<p>Some <strong>bold</strong> and <a href="/x">link</a> text.<script>alert(1)</script></p>
+<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>
+<pre><code class="language-go">fmt.Println(1)</code></pre>
+<table><tr><th>A</th><th>B</th></tr><tr><td>1</td><td>2</td></tr></table>
+<p><img src="/a.png" alt="pic"></p>`, `markdown`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assert.Equal(t, "## Title\n\nSome **bold** and [link](/x) text.\n\n- one\n- two\n\n  1. nested\n\n```go\nfmt.Println(1)\n```\n\n| A | B |\n| --- | --- |\n| 1 | 2 |\n\n![pic](/a.png)", r)
+}
+
+func TestPlainText(t *testing.T) {
+	p := &PipeItem{}
+	r, e := p.CallFilter(`<style>p{}</style><h1>Title</h1><p>Hello
+	   world</p><div>a<br>b</div><ul><li>x</li><li>y</li></ul>`, `plaintext`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assert.Equal(t, "Title\n\nHello world\n\na\nb\n\nx\ny", r)
+}
+
+func TestSanitize(t *testing.T) {
+	p := &PipeItem{}
+	src := `<div class="x"><p onclick="evil()">Hi <b>there</b><script>alert(1)</script></p>` +
+		`<a href="javascript:alert(1)">bad</a> <a href="http://a.com/" rel="me">good</a>` +
+		`<img src="/a.png" onerror="x()"><!-- comment --></div>`
+	r, e := p.CallFilter(src, `sanitize(ugc)`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assert.Equal(t, `<div><p>Hi <b>there</b></p><a>bad</a> <a href="http://a.com/" rel="nofollow">good</a><img src="/a.png"/></div>`, r)
+
+	r, e = p.CallFilter(src, `sanitize(strict)`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assert.Equal(t, `Hi therebad good`, r)
+
+	r, e = p.CallFilter(src, `sanitize`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assert.Equal(t, `<p>Hi <b>there</b></p>bad good`, r)
+
+	RegisterSanitizePolicy(`links`, NewSanitizePolicy().AllowAttrs([]string{`href`}, `a`).AllowURLSchemes(`https`))
+	r, e = p.CallFilter(`<a href="http://a.com/">a</a><a href="https://b.com/">b</a>`, `sanitize(links)`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assert.Equal(t, `<a>a</a><a href="https://b.com/">b</a>`, r)
+}
+
+func TestRewriteURL(t *testing.T) {
+	p := &PipeItem{}
+	src := `<p><img src="loading.gif" data-src="img/a.jpg"><img srcset="/b.jpg 1x, c.jpg 2x"><a href="../x.html">x</a><a href="#top">top</a></p>`
+	r, e := p.CallFilter(src, `rewriteurl(https://www.admpub.com/news/)`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assert.Equal(t, `<p><img src="https://www.admpub.com/news/img/a.jpg"/><img srcset="https://www.admpub.com/b.jpg 1x, https://www.admpub.com/news/c.jpg 2x"/><a href="https://www.admpub.com/x.html">x</a><a href="#top">top</a></p>`, r)
+
+	var stored []string
+	p.SetStorer(func(fileURL, savePath string, fetched bool) (string, error) {
+		stored = append(stored, fileURL)
+		return savePath + `/` + path.Base(fileURL), nil
+	})
+	r, e = p.CallFilter(src, `rewriteurl(https://www.admpub.com/news/,/static)`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assert.Equal(t, `<p><img src="/static/a.jpg"/><img srcset="/static/b.jpg 1x, /static/c.jpg 2x"/><a href="https://www.admpub.com/x.html">x</a><a href="#top">top</a></p>`, r)
+	assert.Equal(t, []string{`https://www.admpub.com/news/img/a.jpg`, `https://www.admpub.com/b.jpg`, `https://www.admpub.com/news/c.jpg`}, stored)
+
+	// data: 网址中的逗号不是分隔符
+	r, e = p.CallFilter(`<img srcset="data:image/png;base64,iVBORw0KGgo= 1x,d.jpg 2x, e.jpg (max-width: 1px, 2px) 3x">`, `rewriteurl(https://www.admpub.com/news/)`)
+	assert.NoError(t, e)
+	assert.Equal(t, `<img srcset="data:image/png;base64,iVBORw0KGgo= 1x, https://www.admpub.com/news/d.jpg 2x, https://www.admpub.com/news/e.jpg (max-width: 1px, 2px) 3x"/>`, r)
+
+	// 保存失败时保留绝对网址，并记录到跟踪信息中
+	p = &PipeItem{Type: PT_TEXT, Filter: `rewriteurl(https://www.admpub.com/,/static)`}
+	p.SetStorer(func(fileURL, savePath string, fetched bool) (string, error) {
+		return ``, errors.New(`disk full`)
+	})
+	trace := NewTrace()
+	p.SetTrace(trace)
+	r, e = p.PipeBytes([]byte(`<img src="a.jpg">`), `text`)
+	assert.NoError(t, e)
+	assert.Equal(t, `<img src="https://www.admpub.com/a.jpg"/>`, r)
+	assert.Contains(t, trace.String(), `warning: Store https://www.admpub.com/a.jpg: disk full`)
+}
+
+func TestArrayFilters(t *testing.T) {
+	p := &PipeItem{}
+	tests := []filterTest{
+		{[]string{`a`, `b`, `a`, `c`}, `unique`, []string{`a`, `b`, `c`}},
+		{[]interface{}{1, `1`, 1}, `unique`, []interface{}{1, `1`}},
+		{[]string{`b`, `a`, `c`}, `sort`, []string{`a`, `b`, `c`}},
+		{[]string{`b`, `a`, `c`}, `sort(desc)`, []string{`c`, `b`, `a`}},
+		{[]string{`10`, `9`, `x`, `100`}, `sort(numeric)`, []string{`9`, `10`, `100`, `x`}},
+		{[]int64{3, 10, 2}, `sort`, []int64{2, 3, 10}},
+		{[]float64{1.5, 3, 2}, `sort(desc)`, []float64{3, 2, 1.5}},
+		{[]string{`a`, `b`, `c`, `d`}, `slice(1,3)`, []string{`b`, `c`}},
+		{[]string{`a`, `b`, `c`, `d`}, `slice(-2)`, []string{`c`, `d`}},
+		{[]string{`a`, `b`, `c`, `d`}, `slice(0,-1)`, []string{`a`, `b`, `c`}},
+		{[]string{`a`, `b`}, `slice(5)`, []string{}},
+		{[]interface{}{`a`, ``, nil, ` `, []string{}, 0, `b`}, `compact`, []interface{}{`a`, 0, `b`}},
+		{[]interface{}{[]string{`a`, `b`}, []interface{}{`c`, []int64{1}}, `d`}, `flatten`, []interface{}{`a`, `b`, `c`, int64(1), `d`}},
+		{[]string{`a`, `b`}, `first`, `a`},
+		{[]string{`a`, `b`}, `last`, `b`},
+		{[]string{}, `first`, nil},
+		{[]string{`a`, `b`}, `count`, 2},
+		{map[string]interface{}{`a`: 1}, `count`, 1},
+		{[]int64{1, 2, 3}, `reverse`, []int64{3, 2, 1}},
+		{[]string{`a`, `b`, `c`}, `chunk(2)`, []interface{}{[]string{`a`, `b`}, []string{`c`}}},
+		{[]string{`b`, `a`, `b`, ``}, `compact|unique|sort|reverse`, []string{`b`, `a`}},
+		{`abc`, `first`, `abc`},
+	}
+	runFilterTests(t, p, tests)
+
+	src := []string{`b`, `a`}
+	p.CallFilter(src, `sort`)
+	assert.Equal(t, []string{`b`, `a`}, src)
+}
+
+func TestMapFilters(t *testing.T) {
+	p := &PipeItem{}
+	src := map[string]interface{}{`a`: 1, `b`: `x`, `info`: map[string]interface{}{`c`: 2, `tags`: []interface{}{`t1`, `t2`}}}
+	tests := []filterTest{
+		{src, `pick(a,b)`, map[string]interface{}{`a`: 1, `b`: `x`}},
+		{src, `omit(info)`, map[string]interface{}{`a`: 1, `b`: `x`}},
+		{src, `rename(a:id,b:name)|omit(info)`, map[string]interface{}{`id`: 1, `name`: `x`}},
+		{src, `rename(a:b,b:a)|omit(info)`, map[string]interface{}{`a`: `x`, `b`: 1}},
+		{src, `merge(info)|omit(tags)`, map[string]interface{}{`a`: 1, `b`: `x`, `c`: 2}},
+		{src, `pick(a)|merge({"d":"y"})`, map[string]interface{}{`a`: 1, `d`: `y`}},
+		{[]interface{}{map[string]interface{}{`a`: 1}, map[string]string{`b`: `2`}}, `merge`, map[string]interface{}{`a`: 1, `b`: `2`}},
+		{src, `get(info.tags[1])`, `t2`},
+		{src, `get(info.tags.0)`, `t1`},
+		{src, `get(info.none)`, nil},
+		{src, `pick(a)|set(x.y,true)`, map[string]interface{}{`a`: 1, `x`: map[string]interface{}{`y`: true}}},
+		{src, `pick(a)|set(a,hello)`, map[string]interface{}{`a`: `hello`}},
+		{src, `keys`, []string{`a`, `b`, `info`}},
+		{src, `pick(a,b)|values`, []interface{}{1, `x`}},
+		{src, `pick(a)|entries`, []interface{}{map[string]interface{}{`key`: `a`, `value`: 1}}},
+		{[]interface{}{map[string]interface{}{`key`: `a`, `value`: 1}, []interface{}{`b`, 2}}, `fromentries`, map[string]interface{}{`a`: 1, `b`: 2}},
+		{[]interface{}{map[string]interface{}{`a`: 1, `b`: 2}, map[string]interface{}{`a`: 3}}, `pick(a)`, []interface{}{map[string]interface{}{`a`: 1}, map[string]interface{}{`a`: 3}}},
+	}
+	runFilterTests(t, p, tests)
+	assert.Equal(t, 3, len(src))
+	assert.Equal(t, 1, src[`a`])
+}
+
+func TestParseFilters(t *testing.T) {
+	calls := parseFilters(`trim|each(substr(0,2)|trim)|replace(()|join(,)`)
+	assert.Equal(t, []filterCall{
+		{name: `trim`},
+		{name: `each`, params: `substr(0,2)|trim`},
+		{name: `replace`, params: `(`},
+		{name: `join`, params: `,`},
+	}, calls)
+}
+
+func TestHigherOrderFilters(t *testing.T) {
+	p := &PipeItem{}
+	items := []interface{}{
+		map[string]interface{}{`name`: `a`, `type`: `x`, `price`: `¥ 150`, `tags`: []interface{}{`go`, `web`}},
+		map[string]interface{}{`name`: `b`, `type`: `y`, `price`: 50.5},
+		map[string]interface{}{`name`: `c`, `type`: `x`, `price`: 99},
+	}
+	tests := []filterTest{
+		{[]string{` abcdef `, ` ghijkl `}, `each(trimspace|substr(0,3))`, []interface{}{`abc`, `ghi`}},
+		{items, `each(get(name))`, []interface{}{`a`, `b`, `c`}},
+		{items, `where(price > 60)|each(get(name))`, []interface{}{`a`, `c`}},
+		{items, `reject(type == x)|each(get(name))`, []interface{}{`b`}},
+		{items, `where(tags contains go)|each(get(name))`, []interface{}{`a`}},
+		{items, `where(name ~ ^[ab]$)|count`, 2},
+		{items, `where(type in ["y"])|each(get(name))`, []interface{}{`b`}},
+		{items, `where(tags)|count`, 1},
+		{items, `where(tags empty)|count`, 2},
+		{[]int64{5, 10, 20}, `where(. >= 10)`, []interface{}{int64(10), int64(20)}},
+		{items, `groupby(type)|each(count)`, map[string]interface{}{`x`: 2, `y`: 1}},
+		{items, `sum(price)`, 299.5},
+		{items, `min(price)`, 50.5},
+		{items, `max(price)`, int64(150)},
+		{[]string{`1`, `2`, `x`}, `avg`, 1.5},
+		{[]int64{1, 2, 3}, `sum`, int64(6)},
+		{[]string{}, `max`, nil},
+	}
+	runFilterTests(t, p, tests)
+}
+
+func TestConditionalFilters(t *testing.T) {
+	p := &PipeItem{}
+	tests := []filterTest{
+		{`free`, `if(contains free,=0,floatval)`, float64(0)},
+		{`Free shipping`, `if(. ~ (?i)free,=0,floatval)`, float64(0)},
+		{`12.5`, `if(contains free,=0,floatval)`, 12.5},
+		{`abc`, `if(. == abc,postadd(d)|postadd(e))`, `abcde`},
+		{`xyz`, `if(. == abc,postadd(d))`, `xyz`},
+		{map[string]interface{}{`stock`: 0}, `if(stock > 0,=in stock,=sold out)`, `sold out`},
+		{``, `default(0)`, float64(0)},
+		{nil, `default(未知)`, `未知`},
+		{`a`, `default(b)`, `a`},
+		{map[string]interface{}{`price`: ``, `sale`: `9.9`}, `coalesce(get(price),get(sale),=0)`, `9.9`},
+		{map[string]interface{}{}, `coalesce(get(price),get(sale),=0)`, float64(0)},
+		{`free`, `switch(^free$=>=0,万$=>floatval,=-1)`, float64(0)},
+		{`3.2万`, `switch(^free$=>=0,万$=>floatval,=-1)`, float64(32000)},
+		{`n/a`, `switch(^free$=>=0,万$=>floatval,=-1)`, float64(-1)},
+		{`n/a`, `switch(^free$=>=0)`, `n/a`},
+	}
+	runFilterTests(t, p, tests)
+
+	body := []byte(`<div><span class="sale"></span><span class="price">9.90</span></div>`)
+	item := PipeItem{
+		Type:   PT_COALESCE,
+		Filter: `floatval`,
+		SubItem: []PipeItem{
+			{Selector: `.sale`, Type: PT_TEXT},
+			{Selector: `.price`, Type: PT_TEXT},
+		},
+	}
+	r, e := item.PipeBytes(body, `html`)
+	assert.NoError(t, e)
+	assert.Equal(t, 9.9, r)
+
+	item.SubItem = item.SubItem[:1]
+	item.Filter = `default(0)`
+	r, e = item.PipeBytes(body, `html`)
+	assert.NoError(t, e)
+	assert.Equal(t, float64(0), r)
+}
+
+func TestEncodeFilters(t *testing.T) {
+	p := &PipeItem{}
+	tests := []filterTest{
+		{`abc`, `md5`, `900150983cd24fb0d6963f7d28e17f72`},
+		{`abc`, `sha1`, `a9993e364706816aba3e25717850c26c9cd0d89d`},
+		{`abc`, `sha256`, `ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad`},
+		{`abc`, `hmac(key)`, `9c196e32dc0175f86f4b1cb89289d6619de6bee699e4c378e68309ed97a1a6ab`},
+		{`abc`, `hmac(k,ey,sha1)`, `f4bee927e1d1a247f58798910f305aaefdff0891`},
+		{`a?b`, `base64encode`, `YT9i`},
+		{`a?b`, `base64encode(url)`, `YT9i`},
+		{"\xfb\xff", `base64encode(url)`, `-_8=`},
+		{`-_8`, `base64decode`, "\xfb\xff"},
+		{`YWJjZA`, `base64decode`, `abcd`},
+		{`a b&c/d`, `urlencode`, `a+b%26c%2Fd`},
+		{`a b&c/d`, `urlencode(path)`, `a%20b&c%2Fd`},
+		{`a+b%26c`, `urldecode`, `a b&c`},
+		{`abc`, `hex`, `616263`},
+		{`abc`, `crc32`, `352441c2`},
+		{`www.example.com`, `uuid5(dns)`, `2ed6657d-e927-568b-95e1-2665a8aea6a2`},
+		{`www.example.com`, `uuid5(6ba7b810-9dad-11d1-80b4-00c04fd430c8)`, `2ed6657d-e927-568b-95e1-2665a8aea6a2`},
+		{[]string{`a`, `b`}, `md5`, []string{`0cc175b9c0f1b6a831c399e269772661`, `92eb5ffee6ae2fec3ad71c777531578f`}},
+		{map[string]interface{}{`id`: 1}, `md5`, map[string]interface{}{`id`: `c4ca4238a0b923820dcc509a6f75849b`}},
+	}
+	runFilterTests(t, p, tests)
+	r, e := p.CallFilter(`a`, `uuid5(mysite)`)
+	assert.NoError(t, e)
+	r2, _ := p.CallFilter(`a`, `uuid5(mysite)`)
+	assert.Equal(t, r, r2)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, r)
+}
+
+func TestURLFilters(t *testing.T) {
+	p := &PipeItem{}
+	tests := []filterTest{
+		{`https://a.com:8080/p?x=1&y=2&y=3#f`, `urlparse`, map[string]interface{}{
+			`scheme`: `https`, `host`: `a.com:8080`, `hostname`: `a.com`, `port`: `8080`, `path`: `/p`,
+			`query`: map[string]interface{}{`x`: `1`, `y`: []string{`2`, `3`}}, `rawquery`: `x=1&y=2&y=3`, `fragment`: `f`,
+		}},
+		{`https://a.com/?id=1&q=a+b`, `queryget(q)`, `a b`},
+		{`https://a.com/?id=1`, `queryget(page)`, ``},
+		{`https://a.com/?id=1&page=1&page=3`, `queryset(page,2)`, `https://a.com/?id=1&page=2`},
+		{`https://a.com/`, `queryset(q,a b&c)`, `https://a.com/?q=a+b%26c`},
+		{`https://a.com/?utm_source=x&id=1&utm_medium=y&fbclid=z#top`, `querydel(utm_*,fbclid)`, `https://a.com/?id=1#top`},
+		{`https://a.com/?utm_source=x`, `querydel(utm_*)`, `https://a.com/`},
+		{`HTTP://A.com:80/a/../b/./?z=1&a=2#top`, `urlnormalize`, `http://a.com/b/?a=2&z=1`},
+		{`https://a.com:8443`, `urlnormalize`, `https://a.com:8443/`},
+		{`http://[::1]:8080/b?z=1&a=2`, `urlnormalize`, `http://[::1]:8080/b?a=2&z=1`},
+		{`http://[FE80::1]:80/`, `urlnormalize`, `http://[fe80::1]/`},
+		{`../img/1.jpg`, `urljoin(https://a.com/news/list/)`, `https://a.com/news/img/1.jpg`},
+		{`http://a.com/x/../a%2Fb/`, `urlnormalize`, `http://a.com/a%2Fb/`},
+		{[]string{`/a`, `//b.com/c`}, `urljoin(https://a.com/news/)`, []string{`https://a.com/a`, `https://b.com/c`}},
+		{map[string]string{`a`: `/a`}, `urljoin(https://a.com/)`, map[string]string{`a`: `https://a.com/a`}},
+		{map[string]interface{}{`a`: `/a`, `n`: 1}, `urljoin(https://a.com/)`, map[string]interface{}{`a`: `https://a.com/a`, `n`: 1}},
+		{[]string{`http://a.com/?x=1`, `:bad`}, `queryget(x)`, []string{`1`, `parse ":bad": missing protocol scheme`}},
+		{[]string{`/p?x=1`}, `urlparse|first|get(path)`, `/p`},
+	}
+	runFilterTests(t, p, tests)
+	_, e := urljoin(p, `/a`, `/news/`)
+	assert.Error(t, e)
+}
+
+func TestChineseFilters(t *testing.T) {
+	p := &PipeItem{}
+	tests := []filterTest{
+		{`头发中国`, `s2t`, `頭髮中國`},
+		{`頭髮中國`, `t2s`, `头发中国`},
+		{`中国银行`, `pinyin`, `zhōng guó yín háng`},
+		{`中国银行`, `pinyin(normal,-)`, `zhong-guo-yin-hang`},
+		{`绿色 ABC`, `pinyin(number)`, `lü4 se4 ABC`},
+		{`北京`, `pinyin(first)`, `bj`},
+		{`二千三百`, `cn2num`, int64(2300)},
+		{[]string{`十五`, `一万零五`}, `cn2num`, []interface{}{int64(15), int64(10005)}},
+		{`第二十三章`, `cn2num(text)`, `第23章`},
+		{`二〇二四年出版了三百本书，第一版售价九十九点五元`, `cn2num(text)`, `2024年出版了300本书，第1版售价99.5元`},
+		{`统一价格`, `cn2num(text)`, `统一价格`},
+		{`一些人`, `cn2num(text)`, `一些人`},
+		{`万一出错，千万不要慌`, `cn2num(text)`, `万一出错，千万不要慌`},
+		{`三五个`, `cn2num(text)`, `三五个`},
+		{`十分重要`, `cn2num(text)`, `十分重要`},
+		{`2300`, `num2cn`, `二千三百`},
+		{2300, `num2cn(upper)`, `贰仟叁佰`},
+		{`15`, `num2cn`, `十五`},
+		{`1001`, `num2cn`, `一千零一`},
+		{`100000`, `num2cn`, `十万`},
+		{`10010000`, `num2cn`, `一千零一万`},
+		{`100010000`, `num2cn`, `一亿零一万`},
+		{`-3.14`, `num2cn`, `负三点一四`},
+		{`第23章`, `num2cn(text)`, `第二十三章`},
+	}
+	runFilterTests(t, p, tests)
+	_, e := pinyin(p, `中国`, `unknown`)
+	assert.Error(t, e)
+}
@@ -6,26 +6,29 @@ require (
 	github.com/PuerkitoBio/goquery v1.9.2
 	github.com/admpub/gohttp v0.0.0-20190322032039-b55c707b8f1e
 	github.com/admpub/regexp2 v1.1.8
-	github.com/axgle/mahonia v0.0.0-20180208002826-3358181d7394
 	github.com/bitly/go-simplejson v0.5.1
+	github.com/dop251/goja v0.0.0-20230806174421-c933cf95e127
 	github.com/stretchr/testify v1.9.0
 	github.com/webx-top/com v1.2.13
+	golang.org/x/net v0.26.0
+	golang.org/x/text v0.16.0
 )
 
 require (
 	github.com/admpub/fsnotify v1.7.0 // indirect
 	github.com/andybalholm/cascadia v1.3.2 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dlclark/regexp2 v1.7.0 // indirect
 	github.com/francoispqt/gojay v1.2.13 // indirect
+	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
 	github.com/goccy/go-json v0.10.3 // indirect
+	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
 	github.com/hashicorp/go-version v1.7.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/crypto v0.24.0 // indirect
-	golang.org/x/net v0.26.0 // indirect
 	golang.org/x/sys v0.21.0 // indirect
-	golang.org/x/text v0.16.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
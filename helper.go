@@ -6,6 +6,11 @@ import (
 	"github.com/webx-top/com"
 )
 
+// isFatalFilterError 终止执行的错误(中止和正则匹配超时)，不会作为数组元素的值
+func isFatalFilterError(err error) bool {
+	return isAbort(err) || IsRegexpTimeout(err)
+}
+
 func _filterValue(src interface{}, fn func(v string) (interface{}, error), fnDefaults ...func(interface{}) (interface{}, error)) (interface{}, error) {
 
 	switch vt := src.(type) {
@@ -16,6 +21,9 @@ func _filterValue(src interface{}, fn func(v string) (interface{}, error), fnDef
 		for i, v := range vt {
 			_v, _e := fn(v)
 			if _e != nil {
+				if isFatalFilterError(_e) {
+					return vt, _e
+				}
 				vt[i] = _e.Error()
 				continue
 			}
@@ -27,6 +35,9 @@ func _filterValue(src interface{}, fn func(v string) (interface{}, error), fnDef
 		for i, v := range vt {
 			_v, _e := fn(v)
 			if _e != nil {
+				if isFatalFilterError(_e) {
+					return vt, _e
+				}
 				vt[i] = _e.Error()
 				continue
 			}
@@ -36,13 +47,21 @@ func _filterValue(src interface{}, fn func(v string) (interface{}, error), fnDef
 
 	case []interface{}:
 		for i, v := range vt {
-			vt[i], _ = _filterValue(v, fn)
+			var _e error
+			vt[i], _e = _filterValue(v, fn, fnDefaults...)
+			if _e != nil && isFatalFilterError(_e) {
+				return vt, _e
+			}
 		}
 		return vt, nil
 
 	case map[string]interface{}:
 		for i, v := range vt {
-			vt[i], _ = _filterValue(v, fn)
+			var _e error
+			vt[i], _e = _filterValue(v, fn, fnDefaults...)
+			if _e != nil && isFatalFilterError(_e) {
+				return vt, _e
+			}
 		}
 		return vt, nil
 
@@ -88,11 +107,18 @@ func SplitParams(params string, separators ...string) []string {
 			if resultLen > 0 {
 				results[resultLen-1] = vt[lastKey]
 			}
-			lastEnd = v[len(v)-1:]
+			lastEnd = lastChar(v)
 			continue
 		}
-		lastEnd = v[len(v)-1:]
+		lastEnd = lastChar(v)
 		results = append(results, v)
 	}
 	return results
 }
+
+func lastChar(v string) string {
+	if len(v) == 0 {
+		return ``
+	}
+	return v[len(v)-1:]
+}
@@ -0,0 +1,138 @@
+package gopiper
+
+import "errors"
+
+// Hook 执行钩子。在每个规则项和每个过滤器执行前后调用，可用于日志记录、统计或替换值。
+// 各方法返回的错误会中止整个执行过程(以 *AbortError 的形式返回给调用者)
+type Hook interface {
+	BeforeItem(pipe *PipeItem) error
+	AfterItem(pipe *PipeItem, result interface{}, err error) (interface{}, error)
+	BeforeFilter(pipe *PipeItem, name string, params string, src interface{}) (interface{}, error)
+	AfterFilter(pipe *PipeItem, name string, params string, result interface{}, err error) (interface{}, error)
+}
+
+// HookFuncs 用函数实现 Hook 接口，未设置的函数不做任何处理
+type HookFuncs struct {
+	BeforeItemFunc   func(pipe *PipeItem) error
+	AfterItemFunc    func(pipe *PipeItem, result interface{}, err error) (interface{}, error)
+	BeforeFilterFunc func(pipe *PipeItem, name string, params string, src interface{}) (interface{}, error)
+	AfterFilterFunc  func(pipe *PipeItem, name string, params string, result interface{}, err error) (interface{}, error)
+}
+
+func (h HookFuncs) BeforeItem(pipe *PipeItem) error {
+	if h.BeforeItemFunc == nil {
+		return nil
+	}
+	return h.BeforeItemFunc(pipe)
+}
+
+func (h HookFuncs) AfterItem(pipe *PipeItem, result interface{}, err error) (interface{}, error) {
+	if h.AfterItemFunc == nil {
+		return result, nil
+	}
+	return h.AfterItemFunc(pipe, result, err)
+}
+
+func (h HookFuncs) BeforeFilter(pipe *PipeItem, name string, params string, src interface{}) (interface{}, error) {
+	if h.BeforeFilterFunc == nil {
+		return src, nil
+	}
+	return h.BeforeFilterFunc(pipe, name, params, src)
+}
+
+func (h HookFuncs) AfterFilter(pipe *PipeItem, name string, params string, result interface{}, err error) (interface{}, error) {
+	if h.AfterFilterFunc == nil {
+		return result, nil
+	}
+	return h.AfterFilterFunc(pipe, name, params, result, err)
+}
+
+// AbortError 钩子中止执行时返回的错误
+type AbortError struct {
+	Err error
+}
+
+func (e *AbortError) Error() string {
+	return "Execution aborted: " + e.Err.Error()
+}
+
+func (e *AbortError) Unwrap() error {
+	return e.Err
+}
+
+func newAbortError(err error) error {
+	var abort *AbortError
+	if errors.As(err, &abort) {
+		return err
+	}
+	return &AbortError{Err: err}
+}
+
+// isAbort 是否为需要中止整个执行过程的错误
+func isAbort(err error) bool {
+	var abort *AbortError
+	return errors.As(err, &abort)
+}
+
+// AddHook 添加执行钩子(按添加顺序调用)
+func (p *PipeItem) AddHook(hooks ...Hook) {
+	p.hooks = append(p.hooks, hooks...)
+}
+
+func (p *PipeItem) Hooks() []Hook {
+	return p.hooks
+}
+
+// beginItem 在规则项执行前调用
+func (p *PipeItem) beginItem() error {
+	p.node = p.trace.begin(p)
+	if err := p.checkDepth(); err != nil {
+		return err
+	}
+	for _, h := range p.hooks {
+		if err := h.BeforeItem(p); err != nil {
+			return newAbortError(err)
+		}
+	}
+	return nil
+}
+
+// endItem 在规则项执行后调用
+func (p *PipeItem) endItem(res *interface{}, err *error) {
+	if *err == nil {
+		*err = p.checkResultLength(*res)
+	}
+	if !isAbort(*err) {
+		for _, h := range p.hooks {
+			v, e := h.AfterItem(p, *res, *err)
+			if e != nil {
+				*err = newAbortError(e)
+				break
+			}
+			*res = v
+		}
+	}
+	p.node.end(*res, *err)
+}
+
+func (p *PipeItem) beforeFilter(name string, params string, src interface{}) (interface{}, error) {
+	for _, h := range p.hooks {
+		v, err := h.BeforeFilter(p, name, params, src)
+		if err != nil {
+			return src, newAbortError(err)
+		}
+		src = v
+	}
+	return src, nil
+}
+
+func (p *PipeItem) afterFilter(name string, params string, result interface{}, err error) (interface{}, error) {
+	for _, h := range p.hooks {
+		v, e := h.AfterFilter(p, name, params, result, err)
+		if e != nil {
+			return result, newAbortError(e)
+		}
+		result = v
+	}
+	return result, err
+}
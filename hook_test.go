@@ -0,0 +1,55 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHook(t *testing.T) {
+	body := []byte(`<ul><li><a href="/a">a</a></li><li><a href="/b">b</a></li></ul>`)
+	pipe := PipeItem{}
+	err := json.Unmarshal([]byte(`{
+		"type": "array",
+		"selector": "ul li",
+		"subitem": [
+			{"type": "text", "selector": "a", "filter": "preadd(x)"}
+		]
+	}`), &pipe)
+	assert.NoError(t, err)
+
+	var items []string
+	pipe.AddHook(HookFuncs{
+		BeforeItemFunc: func(p *PipeItem) error {
+			items = append(items, p.Type)
+			return nil
+		},
+		AfterFilterFunc: func(p *PipeItem, name string, params string, result interface{}, err error) (interface{}, error) {
+			if name == `preadd` {
+				return strings.ToUpper(result.(string)), nil
+			}
+			return result, nil
+		},
+	})
+	v, err := pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"XA", "XB"}, v)
+	assert.Equal(t, []string{"array", "text", "text"}, items)
+
+	errStop := errors.New("stop")
+	pipe.hooks = nil
+	pipe.AddHook(HookFuncs{
+		BeforeFilterFunc: func(p *PipeItem, name string, params string, src interface{}) (interface{}, error) {
+			if src == "b" {
+				return nil, errStop
+			}
+			return src, nil
+		},
+	})
+	_, err = pipe.PipeBytes(body, "html")
+	assert.True(t, errors.Is(err, errStop))
+	assert.True(t, isAbort(err))
+}
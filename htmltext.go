@@ -0,0 +1,343 @@
+package gopiper
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	spaceExp     = regexp.MustCompile(`[ \t\r\n\f]+`)
+	multiLineExp = regexp.MustCompile(`\n{3,}`)
+)
+
+// parseHTMLFragment 解析HTML片段，返回 body 节点
+func parseHTMLFragment(src string) (*html.Node, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(src), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return nil, err
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	return body, nil
+}
+
+func isSkippedNode(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Head, atom.Title, atom.Iframe, atom.Object, atom.Embed:
+		return true
+	}
+	return n.Type == html.CommentNode || n.Type == html.DoctypeNode
+}
+
+func nodeAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ``
+}
+
+// normalizeLines 去掉每行尾部的空白并合并多余的空行
+func normalizeLines(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	s = strings.Join(lines, "\n")
+	return strings.TrimSpace(multiLineExp.ReplaceAllString(s, "\n\n"))
+}
+
+// HTMLToPlainText 将HTML转换为纯文本：删除 script/style 等内容，块级元素之间换行，合并多余空白
+func HTMLToPlainText(src string) (string, error) {
+	body, err := parseHTMLFragment(src)
+	if err != nil {
+		return ``, err
+	}
+	b := &strings.Builder{}
+	plainTextNode(b, body)
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return normalizeLines(strings.Join(lines, "\n")), nil
+}
+
+func plainTextNode(b *strings.Builder, n *html.Node) {
+	if isSkippedNode(n) {
+		return
+	}
+	switch n.Type {
+	case html.TextNode:
+		if pre := closestAtom(n, atom.Pre); pre != nil {
+			b.WriteString(n.Data)
+			return
+		}
+		b.WriteString(spaceExp.ReplaceAllString(n.Data, " "))
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			plainTextNode(b, c)
+		}
+		return
+	}
+	var before, after string
+	switch n.DataAtom {
+	case atom.Br:
+		b.WriteString("\n")
+		return
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Blockquote, atom.Pre, atom.Ul, atom.Ol, atom.Dl, atom.Table, atom.Hr, atom.Figure:
+		before, after = "\n\n", "\n\n"
+	case atom.Div, atom.Li, atom.Tr, atom.Dt, atom.Dd, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Nav, atom.Aside, atom.Main, atom.Address, atom.Figcaption, atom.Caption, atom.Form, atom.Fieldset:
+		before, after = "\n", "\n"
+	case atom.Td, atom.Th:
+		if n.PrevSibling != nil {
+			before = "\t"
+		}
+	case atom.Img:
+		b.WriteString(nodeAttr(n, "alt"))
+		return
+	}
+	writeBreak(b, before)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		plainTextNode(b, c)
+	}
+	writeBreak(b, after)
+}
+
+// writeBreak 写入换行(已有的换行不重复写入)
+func writeBreak(b *strings.Builder, brk string) {
+	if brk != "\n" && brk != "\n\n" {
+		b.WriteString(brk)
+		return
+	}
+	s := strings.TrimRight(b.String(), " \t")
+	n := len(s) - len(strings.TrimRight(s, "\n"))
+	if n < len(brk) && (len(s) > 0 || n > 0) {
+		b.WriteString(brk[n:])
+	}
+}
+
+func closestAtom(n *html.Node, a atom.Atom) *html.Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.DataAtom == a {
+			return p
+		}
+	}
+	return nil
+}
+
+// HTMLToMarkdown 将HTML转换为Markdown(支持标题、列表、链接、图片、表格和代码)
+func HTMLToMarkdown(src string) (string, error) {
+	body, err := parseHTMLFragment(src)
+	if err != nil {
+		return ``, err
+	}
+	return normalizeLines(markdownChildren(body)), nil
+}
+
+func markdownChildren(n *html.Node) string {
+	b := &strings.Builder{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(markdownNode(c))
+	}
+	return b.String()
+}
+
+// markdownInline 行内内容：合并空白，不允许换行(br除外)
+func markdownInline(n *html.Node) string {
+	s := markdownChildren(n)
+	return strings.TrimSpace(strings.Replace(s, "\n\n", "\n", -1))
+}
+
+func markdownBlock(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return ``
+	}
+	return "\n\n" + s + "\n\n"
+}
+
+func prefixLines(s string, first string, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = first + line
+		} else if len(line) > 0 {
+			lines[i] = rest + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func markdownNode(n *html.Node) string {
+	if isSkippedNode(n) {
+		return ``
+	}
+	switch n.Type {
+	case html.TextNode:
+		return spaceExp.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return markdownChildren(n)
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level, _ := strconv.Atoi(n.Data[1:])
+		return markdownBlock(strings.Repeat("#", level) + " " + strings.Replace(markdownInline(n), "\n", " ", -1))
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main, atom.Figure, atom.Figcaption, atom.Address, atom.Dl, atom.Dt, atom.Dd:
+		return markdownBlock(markdownChildren(n))
+	case atom.Br:
+		return "  \n"
+	case atom.Hr:
+		return markdownBlock("---")
+	case atom.Strong, atom.B:
+		if s := markdownInline(n); len(s) > 0 {
+			return "**" + s + "**"
+		}
+		return ``
+	case atom.Em, atom.I:
+		if s := markdownInline(n); len(s) > 0 {
+			return "*" + s + "*"
+		}
+		return ``
+	case atom.Del, atom.S, atom.Strike:
+		if s := markdownInline(n); len(s) > 0 {
+			return "~~" + s + "~~"
+		}
+		return ``
+	case atom.Code:
+		if n.Parent != nil && n.Parent.DataAtom == atom.Pre {
+			return textContent(n)
+		}
+		s := textContent(n)
+		fence := "`"
+		if strings.Contains(s, "`") {
+			fence = "``"
+		}
+		return fence + s + fence
+	case atom.Pre:
+		lang := ``
+		if c := n.FirstChild; c != nil && c.DataAtom == atom.Code {
+			for _, class := range strings.Fields(nodeAttr(c, "class")) {
+				if strings.HasPrefix(class, "language-") {
+					lang = strings.TrimPrefix(class, "language-")
+				}
+			}
+		}
+		code := strings.Trim(textContent(n), "\n")
+		return "\n\n```" + lang + "\n" + code + "\n```\n\n"
+	case atom.A:
+		text := markdownInline(n)
+		href := nodeAttr(n, "href")
+		if len(href) == 0 || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return text
+		}
+		if len(text) == 0 {
+			text = href
+		}
+		if title := nodeAttr(n, "title"); len(title) > 0 {
+			return "[" + text + "](" + href + " " + strconv.Quote(title) + ")"
+		}
+		return "[" + text + "](" + href + ")"
+	case atom.Img:
+		src := nodeAttr(n, "src")
+		if len(src) == 0 {
+			return ``
+		}
+		return "![" + nodeAttr(n, "alt") + "](" + src + ")"
+	case atom.Ul, atom.Ol:
+		return markdownBlock(markdownList(n))
+	case atom.Blockquote:
+		s := normalizeLines(markdownChildren(n))
+		if len(s) == 0 {
+			return ``
+		}
+		return markdownBlock(prefixLines(s, "> ", "> "))
+	case atom.Table:
+		return markdownBlock(markdownTable(n))
+	}
+	return markdownChildren(n)
+}
+
+func markdownList(n *html.Node) string {
+	var items []string
+	index := 1
+	if start, err := strconv.Atoi(nodeAttr(n, "start")); err == nil {
+		index = start
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(index) + ". "
+			index++
+		}
+		s := normalizeLines(markdownChildren(c))
+		items = append(items, prefixLines(s, marker, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+func markdownTable(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			switch c.DataAtom {
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(c)
+			case atom.Tr:
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						text := strings.Replace(markdownInline(cell), "\n", " ", -1)
+						row = append(row, strings.Replace(strings.TrimSpace(text), "|", `\|`, -1))
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return ``
+	}
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	lines := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, ``)
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	b := &strings.Builder{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
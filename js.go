@@ -0,0 +1,236 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+var (
+	// DefaultScriptTimeout 脚本的默认最长执行时间
+	DefaultScriptTimeout = time.Second
+	// DefaultScriptMemory 脚本执行期间默认最多分配的内存(字节)
+	DefaultScriptMemory = 64 << 20
+	// MaxScriptCallStackSize 脚本的最大函数调用深度
+	MaxScriptCallStackSize = 1024
+	// MaxScriptCache 缓存的已编译脚本数量上限(引用的值会以字面量替换到脚本中，脚本内容可能各不相同)
+	MaxScriptCache = 1000
+
+	scriptPrograms = newLRUCache() // 已编译的脚本
+)
+
+// scriptMemoryMetric 进程累计分配的堆内存。脚本执行期间的分配量按此估算(包含同时运行的其它 goroutine 的分配)，
+// 因此超出内存限制时只作为过滤器的错误，不会终止整个规则的执行
+const scriptMemoryMetric = `/gc/heap/allocs:bytes`
+
+// scriptPrelude 限制 repeat、padStart、padEnd 生成的字符串长度，避免在两次检查内存之间一次分配大量内存
+const scriptPrelude = `(function (max) {
+	var proto = String.prototype;
+	['repeat', 'padStart', 'padEnd'].forEach(function (name) {
+		var fn = proto[name];
+		Object.defineProperty(proto, name, {
+			value: function (n) {
+				var size = name === 'repeat' ? String(this).length * n : n;
+				if (size > max) {
+					throw new RangeError('Invalid string length');
+				}
+				return fn.apply(this, arguments);
+			},
+			writable: true,
+			configurable: true
+		});
+	});
+})`
+
+func compileScript(code string) (*goja.Program, error) {
+	if prg, ok := scriptPrograms.get(code); ok {
+		return prg.(*goja.Program), nil
+	}
+	prg, err := goja.Compile(``, code, false)
+	if err != nil {
+		return nil, err
+	}
+	scriptPrograms.add(code, prg, MaxScriptCache)
+	return prg, nil
+}
+
+// scriptValue 复制传给脚本的值，避免脚本修改原数据
+func scriptValue(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil, string, bool, int, int64, float64:
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	err = json.Unmarshal(b, &res)
+	return res, err
+}
+
+func (p *PipeItem) scriptLimits() (time.Duration, uint64) {
+	timeout, memory := DefaultScriptTimeout, DefaultScriptMemory
+	if p.limits != nil {
+		if p.limits.ScriptTimeout > 0 {
+			timeout = time.Duration(p.limits.ScriptTimeout) * time.Millisecond
+		}
+		if p.limits.ScriptMemory > 0 {
+			memory = p.limits.ScriptMemory
+		}
+	}
+	return timeout, uint64(memory)
+}
+
+func heapAllocs() uint64 {
+	sample := []metrics.Sample{{Name: scriptMemoryMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// setupScriptRuntime 限制脚本单次生成的字符串长度
+func setupScriptRuntime(vm *goja.Runtime, memory uint64) error {
+	prelude, err := compileScript(scriptPrelude)
+	if err != nil {
+		return err
+	}
+	v, err := vm.RunProgram(prelude)
+	if err != nil {
+		return err
+	}
+	fn, _ := goja.AssertFunction(v)
+	_, err = fn(goja.Undefined(), vm.ToValue(memory))
+	return err
+}
+
+// RunScript 执行JavaScript脚本并返回最后一个语句的值。
+// 脚本中 value 为当前值，$ 为同一map中已提取的字段，parent 为上一级map中的字段，params 为过滤器参数。
+// 脚本中不能访问文件和网络，执行时间和内存分配超出限制时返回 LimitError。
+// 内存分配量是估算值(见 scriptMemoryMetric)，超出时返回的错误不会终止整个规则的执行
+func (p *PipeItem) RunScript(code string, value interface{}, params string) (interface{}, error) {
+	prg, err := compileScript(code)
+	if err != nil {
+		return nil, err
+	}
+	timeout, memory := p.scriptLimits()
+	vm := goja.New()
+	vm.SetMaxCallStackSize(MaxScriptCallStackSize)
+	if err = setupScriptRuntime(vm, memory); err != nil {
+		return nil, err
+	}
+	var siblings, parent interface{}
+	if p.scope != nil {
+		siblings = p.scope.values
+		if p.scope.parent != nil {
+			parent = p.scope.parent.values
+		}
+	}
+	for name, v := range map[string]interface{}{`value`: value, `$`: siblings, `parent`: parent} {
+		if v, err = scriptValue(v); err != nil {
+			return nil, err
+		}
+		if err = vm.Set(name, v); err != nil {
+			return nil, err
+		}
+	}
+	if err = vm.Set(`params`, params); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		start := heapAllocs()
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+				vm.Interrupt(&LimitError{Limit: `scriptTimeout`, Max: int(timeout / time.Millisecond)})
+				return
+			case <-ticker.C:
+				if heapAllocs()-start > memory {
+					vm.Interrupt(&LimitError{Limit: `scriptMemory`, Max: int(memory)})
+					return
+				}
+			}
+		}
+	}()
+
+	res, err := vm.RunProgram(prg)
+	if err != nil {
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			if limitErr.Limit == `scriptMemory` {
+				return nil, limitErr
+			}
+			return nil, newAbortError(limitErr)
+		}
+		return nil, err
+	}
+	if res == nil || goja.IsUndefined(res) || goja.IsNull(res) {
+		return nil, nil
+	}
+	if _, ok := goja.AssertFunction(res); ok {
+		return nil, errors.New("Script result can't be a function")
+	}
+	v := res.Export()
+	if n, ok := v.(float64); ok && (math.IsNaN(n) || math.IsInf(n, 0)) {
+		return nil, fmt.Errorf("Script result is not a finite number: %v", n)
+	}
+	return v, nil
+}
+
+// js(value.toUpperCase()) => src="abc" => "ABC"
+// js(value.split(",").map(s => s.trim())) => src="a, b" => ["a","b"]
+func js(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return pipe.RunScript(params, src, ``)
+}
+
+// RegisterScriptFilter 注册用JavaScript编写的过滤器。脚本中 value 为当前值，params 为过滤器参数
+func RegisterScriptFilter(name string, code string, description string) error {
+	if _, existing := filters[name]; existing {
+		return fmt.Errorf("Filter with name '%s' is already registered", name)
+	}
+	if _, err := compileScript(code); err != nil {
+		return fmt.Errorf("Script filter %s: %w", name, err)
+	}
+	RegisterFilter(name, scriptFilter(code), description, name+`(params)`, ``)
+	return nil
+}
+
+func scriptFilter(code string) FilterFunction {
+	return func(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+		return pipe.RunScript(code, src, params)
+	}
+}
+
+// scriptFilters 返回当前规则及上级规则中定义的脚本过滤器(Scripts)
+func (p *PipeItem) scriptFilters() map[string]string {
+	if len(p.Scripts) == 0 {
+		return p.scripts
+	}
+	if len(p.scripts) == 0 {
+		return p.Scripts
+	}
+	res := make(map[string]string, len(p.scripts)+len(p.Scripts))
+	for name, code := range p.scripts {
+		res[name] = code
+	}
+	for name, code := range p.Scripts {
+		res[name] = code
+	}
+	return res
+}
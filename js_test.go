@@ -0,0 +1,85 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScriptFilter(t *testing.T) {
+	p := &PipeItem{}
+	tests := []filterTest{
+		{`abc`, `js(value.toUpperCase())`, `ABC`},
+		{`a, b`, `js(value.split(",").map(s => s.trim()))`, []interface{}{`a`, `b`}},
+		{`3`, `js(parseInt(value) * 2)|intval`, 6},
+		{map[string]interface{}{`a`: 1}, `js(value.a = 2; value)`, map[string]interface{}{`a`: int64(2)}},
+		{`x`, `js(undefined)`, nil},
+	}
+	runFilterTests(t, p, tests)
+
+	// 脚本不会修改原数据
+	src := map[string]interface{}{`a`: 1}
+	_, e := p.CallFilter(src, `js(value.a = 2)`)
+	assert.NoError(t, e)
+	assert.Equal(t, 1, src[`a`])
+
+	p.SetLimits(&Limits{ScriptTimeout: 50})
+	_, e = p.RunScript(`while (true) {}`, nil, ``)
+	assert.True(t, errors.Is(e, ErrLimitExceeded))
+	assert.True(t, isAbort(e))
+	_, e = p.RunScript(`var a = []; while (true) { a.push("xxxxxxxxxx" + a.length) }`, nil, ``)
+	assert.True(t, errors.Is(e, ErrLimitExceeded))
+	p.SetLimits(&Limits{ScriptTimeout: 10000, ScriptMemory: 1 << 20})
+	_, e = p.RunScript(`var a = []; while (true) { a.push("xxxxxxxxxx" + a.length) }`, nil, ``)
+	var limitErr *LimitError
+	if assert.True(t, errors.As(e, &limitErr)) {
+		assert.Equal(t, `scriptMemory`, limitErr.Limit)
+	}
+	assert.False(t, isAbort(e))
+	_, e = p.RunScript(`"x".repeat(1e9)`, nil, ``)
+	assert.Error(t, e)
+	r, e := p.RunScript(`"ab".repeat(3).padStart(8, "-")`, nil, ``)
+	assert.NoError(t, e)
+	assert.Equal(t, `--ababab`, r)
+	p.SetLimits(&Limits{ScriptTimeout: 50})
+	_, e = p.RunScript(`function f() { return f() }; f()`, nil, ``)
+	assert.Error(t, e)
+	_, e = p.RunScript(`require("fs")`, nil, ``)
+	assert.Error(t, e)
+	_, e = p.RunScript(`0 / 0`, nil, ``)
+	assert.Error(t, e)
+
+	// 已编译脚本的缓存数量有上限
+	defer func(max int) { MaxScriptCache = max }(MaxScriptCache)
+	MaxScriptCache = 2
+	for _, code := range []string{`1`, `2`, `3`, `4`} {
+		_, e = p.RunScript(code, nil, ``)
+		assert.NoError(t, e)
+	}
+	assert.True(t, scriptPrograms.len() <= 2)
+
+	assert.NoError(t, RegisterScriptFilter(`jsslug`, `value.trim().toLowerCase().replace(/\s+/g, params || "-")`, `生成 slug`))
+	assert.Error(t, RegisterScriptFilter(`jsslug`, `value`, ``))
+	r, e = p.CallFilter(` Hello World `, `jsslug(_)`)
+	assert.NoError(t, e)
+	assert.Equal(t, `hello_world`, r)
+
+	var item PipeItem
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"type": "map",
+		"scripts": {"total": "parent.price * parent.qty"},
+		"subitem": [
+			{"name": "price", "type": "float", "selector": ".price"},
+			{"name": "qty", "type": "int", "selector": ".qty"},
+			{"name": "info", "type": "map", "subitem": [
+				{"name": "title", "type": "text", "selector": "h1", "filter": "js(value + ' x' + parent.qty)"},
+				{"name": "total", "type": "text", "selector": ".price", "filter": "total"}
+			]}
+		]
+	}`), &item))
+	r, e = item.PipeBytes([]byte(`<div><span class="price">2.5</span><span class="qty">4</span><h1>Phone</h1></div>`), `html`)
+	assert.NoError(t, e)
+	assert.Equal(t, map[string]interface{}{`price`: 2.5, `qty`: int64(4), `info`: map[string]interface{}{`title`: `Phone x4`, `total`: int64(10)}}, r)
+}
@@ -0,0 +1,127 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Limits 执行资源限制(用于执行不完全可信的规则)。值小于等于0代表不限制
+type Limits struct {
+	MaxDepth       int `json:"maxDepth,omitempty"`       // 子规则(SubItem)最大嵌套深度
+	MaxArrayLength int `json:"maxArrayLength,omitempty"` // 单个数组结果的最大元素数量
+	MaxPaging      int `json:"maxPaging,omitempty"`      // paging 过滤器最多生成的网址数量
+	MaxFetch       int `json:"maxFetch,omitempty"`       // 单次执行中 fetch、saveto 和 rewriteurl 过滤器最多抓取(保存)网址的次数
+	MaxOutputSize  int `json:"maxOutputSize,omitempty"`  // 结果序列化为JSON后的最大字节数
+	ScriptTimeout  int `json:"scriptTimeout,omitempty"`  // 单次执行脚本的最长时间(毫秒)，未设置时使用 DefaultScriptTimeout
+	ScriptMemory   int `json:"scriptMemory,omitempty"`   // 单次执行脚本期间最多分配的内存(字节)，未设置时使用 DefaultScriptMemory
+}
+
+// LimitError 超出执行资源限制
+type LimitError struct {
+	Limit string
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Execution limit exceeded: %s (max %d)", e.Limit, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+func newLimitError(limit string, max int) error {
+	return newAbortError(&LimitError{Limit: limit, Max: max})
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// execCounter 单次执行中共享的计数器
+type execCounter struct {
+	fetches int
+}
+
+// SetLimits 设置本次执行的资源限制
+func (p *PipeItem) SetLimits(limits *Limits) {
+	p.limits = limits
+}
+
+func (p *PipeItem) Limits() *Limits {
+	return p.limits
+}
+
+func (p *PipeItem) checkDepth() error {
+	if p.limits == nil || p.limits.MaxDepth <= 0 || p.depth <= p.limits.MaxDepth {
+		return nil
+	}
+	return newLimitError(`maxDepth`, p.limits.MaxDepth)
+}
+
+func (p *PipeItem) checkArrayLength(size int) error {
+	if p.limits == nil || p.limits.MaxArrayLength <= 0 || size <= p.limits.MaxArrayLength {
+		return nil
+	}
+	return newLimitError(`maxArrayLength`, p.limits.MaxArrayLength)
+}
+
+func (p *PipeItem) checkResultLength(res interface{}) error {
+	if p.limits == nil || p.limits.MaxArrayLength <= 0 || res == nil {
+		return nil
+	}
+	v := reflect.ValueOf(res)
+	if v.Kind() != reflect.Slice {
+		return nil
+	}
+	return p.checkArrayLength(v.Len())
+}
+
+func (p *PipeItem) checkPaging(size int) error {
+	if p.limits == nil || p.limits.MaxPaging <= 0 || size <= p.limits.MaxPaging {
+		return nil
+	}
+	return newLimitError(`maxPaging`, p.limits.MaxPaging)
+}
+
+// pagingCount 计算 paging 过滤器生成的网址数量，溢出时返回 false
+func pagingCount(start, end, size int) (int, bool) {
+	if end < start {
+		return 0, true
+	}
+	span := end - start + 1
+	if span <= 0 {
+		return 0, false
+	}
+	if size > 0 && span > maxInt/size {
+		return 0, false
+	}
+	return span * size, true
+}
+
+func (p *PipeItem) countFetch(n int) error {
+	if p.limits == nil || p.limits.MaxFetch <= 0 {
+		return nil
+	}
+	if p.counter == nil {
+		p.counter = &execCounter{}
+	}
+	p.counter.fetches += n
+	if p.counter.fetches > p.limits.MaxFetch {
+		return newLimitError(`maxFetch`, p.limits.MaxFetch)
+	}
+	return nil
+}
+
+func (p *PipeItem) checkOutputSize(res interface{}) error {
+	if p.limits == nil || p.limits.MaxOutputSize <= 0 || res == nil {
+		return nil
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	if len(b) > p.limits.MaxOutputSize {
+		return newLimitError(`maxOutputSize`, p.limits.MaxOutputSize)
+	}
+	return nil
+}
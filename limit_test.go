@@ -0,0 +1,89 @@
+package gopiper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimits(t *testing.T) {
+	body := []byte(`<ul><li>a</li><li>b</li><li>c</li></ul>`)
+	pipe := PipeItem{
+		Type:     "array",
+		Selector: "li",
+		SubItem:  []PipeItem{{Type: "text"}},
+	}
+	pipe.SetLimits(&Limits{MaxArrayLength: 2})
+	_, err := pipe.PipeBytes(body, "html")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	var limitErr *LimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, `maxArrayLength`, limitErr.Limit)
+
+	pipe.SetLimits(&Limits{MaxDepth: 1})
+	v, err := pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b", "c"}, v)
+
+	pipe = PipeItem{
+		Type: "map",
+		SubItem: []PipeItem{
+			{Name: "list", Type: "array", Selector: "li", SubItem: []PipeItem{{Type: "text"}}},
+		},
+	}
+	pipe.SetLimits(&Limits{MaxDepth: 1})
+	_, err = pipe.PipeBytes(body, "html")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+
+	pipe.SetLimits(&Limits{MaxOutputSize: 10})
+	_, err = pipe.PipeBytes(body, "html")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+
+	pipe = PipeItem{Type: "string"}
+	pipe.SetLimits(&Limits{MaxPaging: 100})
+	_, err = pipe.CallFilter(`http://x/{0}`, `paging(1,100000000)`)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	v, err = pipe.CallFilter(`http://x/{0}`, `paging(1,3)`)
+	assert.NoError(t, err)
+	assert.Len(t, v, 3)
+	_, err = pipe.CallFilter(`http://x/{0}`, `paging(0,9223372036854775807)`)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	_, err = paging(&PipeItem{}, `http://x/{0}`, `-9223372036854775808,9223372036854775807`)
+	assert.Error(t, err)
+	_, err = paging(&PipeItem{}, []string{`a`, `b`}, `0,9223372036854775806`)
+	assert.Error(t, err)
+
+	fetched := 0
+	pipe.SetFetcher(func(pageURL string) ([]byte, error) {
+		fetched++
+		return []byte(pageURL), nil
+	})
+	pipe.SetLimits(&Limits{MaxFetch: 2})
+	_, err = pipe.CallFilter([]string{`a`, `b`, `c`}, `fetch`)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	assert.Equal(t, 2, fetched)
+	fetched = 0
+	pipe = PipeItem{Type: "string", fetcher: pipe.fetcher}
+	pipe.SetLimits(&Limits{MaxFetch: 2})
+	_, err = pipe.CallFilter(map[string]interface{}{`a`: `a`, `list`: []interface{}{`b`, `c`}}, `fetch`)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	assert.Equal(t, 2, fetched)
+
+	stored := 0
+	pipe = PipeItem{Type: "string"}
+	pipe.SetStorer(func(fileURL, savePath string, fetched bool) (string, error) {
+		stored++
+		return `/files/` + fileURL, nil
+	})
+	pipe.SetLimits(&Limits{MaxFetch: 2})
+	_, err = pipe.CallFilter(map[string]interface{}{`a`: `a`, `list`: []interface{}{`b`, `c`}}, `saveto(/files)`)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	assert.Equal(t, 2, stored)
+	stored = 0
+	pipe = PipeItem{Type: "string", storer: pipe.storer}
+	pipe.SetLimits(&Limits{MaxFetch: 2})
+	_, err = pipe.CallFilter(`<img src="a.png"><img src="b.png"><img src="c.png">`, `rewriteurl(http://x/,/files)`)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	assert.Equal(t, 2, stored)
+}
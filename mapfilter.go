@@ -0,0 +1,341 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// toMap 将 map[string]string 等转为 map[string]interface{}
+func toMap(src interface{}) (map[string]interface{}, bool) {
+	switch vt := src.(type) {
+	case map[string]interface{}:
+		return vt, true
+	case map[string]string:
+		m := make(map[string]interface{}, len(vt))
+		for k, v := range vt {
+			m[k] = v
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+// copyMap 浅复制map(不修改原map)
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+// _filterMap 对map执行fn。src为数组时对其中的每个map执行fn
+func _filterMap(src interface{}, fn func(m map[string]interface{}) (interface{}, error)) (interface{}, error) {
+	if m, ok := toMap(src); ok {
+		return fn(m)
+	}
+	items, ok := toInterfaceSlice(src)
+	if !ok {
+		return src, ErrNotMap
+	}
+	res := make([]interface{}, len(items))
+	for i, item := range items {
+		m, ok := toMap(item)
+		if !ok {
+			res[i] = item
+			continue
+		}
+		v, err := fn(m)
+		if err != nil {
+			return src, err
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+// splitPath 分割路径。例如：a.b[0].c 或 a.b.0.c => [a b 0 c]
+func splitPath(path string) []string {
+	path = strings.Replace(strings.Replace(path, `[`, `.`, -1), `]`, ``, -1)
+	parts := strings.Split(path, `.`)
+	res := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); len(part) > 0 {
+			res = append(res, part)
+		}
+	}
+	return res
+}
+
+// GetPath 按路径获取map或数组中的值。例如：a.b[0].c
+func GetPath(src interface{}, path string) (interface{}, bool) {
+	v := src
+	for _, key := range splitPath(path) {
+		if m, ok := toMap(v); ok {
+			if v, ok = m[key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		items, ok := toInterfaceSlice(v)
+		if !ok {
+			return nil, false
+		}
+		index, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, false
+		}
+		if index < 0 {
+			index += len(items)
+		}
+		if index < 0 || index >= len(items) {
+			return nil, false
+		}
+		v = items[index]
+	}
+	return v, true
+}
+
+// SetPath 按路径设置值，不存在的中间节点会自动创建为map。返回修改后的副本(不修改原数据)
+func SetPath(src interface{}, path string, value interface{}) (interface{}, error) {
+	keys := splitPath(path)
+	if len(keys) == 0 {
+		return value, nil
+	}
+	return setPath(src, keys, value)
+}
+
+func setPath(src interface{}, keys []string, value interface{}) (interface{}, error) {
+	if len(keys) == 0 {
+		return value, nil
+	}
+	key := keys[0]
+	if items, ok := toInterfaceSlice(src); ok {
+		index, err := strconv.Atoi(key)
+		if err != nil {
+			return src, fmt.Errorf("Invalid array index: %s", key)
+		}
+		if index < 0 {
+			index += len(items)
+		}
+		if index < 0 || index >= len(items) {
+			return src, fmt.Errorf("Array index out of range: %s", key)
+		}
+		cp := make([]interface{}, len(items))
+		copy(cp, items)
+		if cp[index], err = setPath(cp[index], keys[1:], value); err != nil {
+			return src, err
+		}
+		return cp, nil
+	}
+	m, ok := toMap(src)
+	if ok {
+		m = copyMap(m)
+	} else if src == nil {
+		m = map[string]interface{}{}
+	} else {
+		return src, fmt.Errorf("Can't set %s: %w", key, ErrNotMap)
+	}
+	var err error
+	m[key], err = setPath(m[key], keys[1:], value)
+	return m, err
+}
+
+// parseParamValue 将参数解析为JSON值(数值、布尔值、null、带引号的字符串、数组或对象)，不是JSON时作为字符串
+func parseParamValue(param string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(param)), &v); err == nil {
+		return v
+	}
+	return param
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pick(a,b) => src={"a":1,"b":2,"c":3} => {"a":1,"b":2}
+func pick(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	keys := SplitParams(params)
+	return _filterMap(src, func(m map[string]interface{}) (interface{}, error) {
+		res := make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			key = strings.TrimSpace(key)
+			if v, ok := m[key]; ok {
+				res[key] = v
+			}
+		}
+		return res, nil
+	})
+}
+
+// omit(c) => src={"a":1,"b":2,"c":3} => {"a":1,"b":2}
+func omit(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	keys := SplitParams(params)
+	return _filterMap(src, func(m map[string]interface{}) (interface{}, error) {
+		res := copyMap(m)
+		for _, key := range keys {
+			delete(res, strings.TrimSpace(key))
+		}
+		return res, nil
+	})
+}
+
+// rename(a:x,b:y) => src={"a":1,"b":2} => {"x":1,"y":2}
+// rename(a:b,b:a) => src={"a":1,"b":2} => {"a":2,"b":1}
+func rename(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	pairs := SplitParams(params)
+	return _filterMap(src, func(m map[string]interface{}) (interface{}, error) {
+		res := copyMap(m)
+		renamed := make(map[string]interface{}, len(pairs))
+		// 先删除所有旧键再设置新键，以便交换键名
+		for _, pair := range pairs {
+			kv := strings.SplitN(pair, `:`, 2)
+			if len(kv) != 2 {
+				return m, fmt.Errorf("Filter rename invalid param: %s", pair)
+			}
+			oldKey, newKey := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+			if v, ok := m[oldKey]; ok {
+				delete(res, oldKey)
+				renamed[newKey] = v
+			}
+		}
+		for k, v := range renamed {
+			res[k] = v
+		}
+		return res, nil
+	})
+}
+
+// merge => src=[{"a":1},{"b":2}] => {"a":1,"b":2}
+// merge(info) => src={"a":1,"info":{"b":2}} => {"a":1,"b":2}
+// merge({"c":3}) => src={"a":1} => {"a":1,"c":3}
+func merge(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	params = strings.TrimSpace(params)
+	if m, ok := toMap(src); ok {
+		res := copyMap(m)
+		if strings.HasPrefix(params, `{`) {
+			extra := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(params), &extra); err != nil {
+				return src, err
+			}
+			for k, v := range extra {
+				res[k] = v
+			}
+			return res, nil
+		}
+		for _, key := range SplitParams(params) {
+			key = strings.TrimSpace(key)
+			sub, ok := toMap(m[key])
+			if !ok {
+				continue
+			}
+			delete(res, key)
+			for k, v := range sub {
+				res[k] = v
+			}
+		}
+		return res, nil
+	}
+	items, ok := toInterfaceSlice(src)
+	if !ok {
+		return src, ErrNotMap
+	}
+	res := map[string]interface{}{}
+	for _, item := range items {
+		m, ok := toMap(item)
+		if !ok {
+			continue
+		}
+		for k, v := range m {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+// get(a.b[0]) => src={"a":{"b":["x"]}} => "x"
+func mapGet(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	v, _ := GetPath(src, params)
+	return v, nil
+}
+
+// set(a.b,1) => src={"a":{}} => {"a":{"b":1}}
+func mapSet(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	args := strings.SplitN(params, `,`, 2)
+	if len(args) != 2 {
+		return src, errors.New("Filter set need two params")
+	}
+	return _filterMap(src, func(m map[string]interface{}) (interface{}, error) {
+		return SetPath(m, args[0], parseParamValue(args[1]))
+	})
+}
+
+// keys => src={"b":1,"a":2} => ["a","b"]
+func mapKeys(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	m, ok := toMap(src)
+	if !ok {
+		return src, ErrNotMap
+	}
+	return sortedKeys(m), nil
+}
+
+// values => src={"b":1,"a":2} => [2,1]
+func mapValues(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	m, ok := toMap(src)
+	if !ok {
+		return src, ErrNotMap
+	}
+	res := make([]interface{}, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		res = append(res, m[k])
+	}
+	return res, nil
+}
+
+// entries => src={"a":1} => [{"key":"a","value":1}]
+func mapEntries(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	m, ok := toMap(src)
+	if !ok {
+		return src, ErrNotMap
+	}
+	res := make([]interface{}, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		res = append(res, map[string]interface{}{"key": k, "value": m[k]})
+	}
+	return res, nil
+}
+
+// fromentries => src=[{"key":"a","value":1},["b",2]] => {"a":1,"b":2}
+func fromentries(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	items, ok := toInterfaceSlice(src)
+	if !ok {
+		return src, errors.New("Filter fromentries need array value")
+	}
+	res := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		if m, ok := toMap(item); ok {
+			k, ok := m["key"]
+			if !ok {
+				return src, errors.New("Filter fromentries: entry has no key")
+			}
+			res[fmt.Sprint(k)] = m["value"]
+			continue
+		}
+		pair, ok := toInterfaceSlice(item)
+		if !ok || len(pair) != 2 {
+			return src, errors.New("Filter fromentries: invalid entry")
+		}
+		res[fmt.Sprint(pair[0])] = pair[1]
+	}
+	return res, nil
+}
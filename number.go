@@ -0,0 +1,350 @@
+package gopiper
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NumberFormat 数字的千位分隔符和小数点
+type NumberFormat struct {
+	Thousands string
+	Decimal   string
+}
+
+// NumberLocales 各地区的数字格式。键为语言代码(不区分大小写，de-DE 和 de_DE 会按 de 查找)
+var NumberLocales = map[string]NumberFormat{
+	`en`: {Thousands: `,`, Decimal: `.`},
+	`zh`: {Thousands: `,`, Decimal: `.`},
+	`ja`: {Thousands: `,`, Decimal: `.`},
+	`ko`: {Thousands: `,`, Decimal: `.`},
+	`de`: {Thousands: `.`, Decimal: `,`},
+	`es`: {Thousands: `.`, Decimal: `,`},
+	`it`: {Thousands: `.`, Decimal: `,`},
+	`nl`: {Thousands: `.`, Decimal: `,`},
+	`pt`: {Thousands: `.`, Decimal: `,`},
+	`id`: {Thousands: `.`, Decimal: `,`},
+	`tr`: {Thousands: `.`, Decimal: `,`},
+	`fr`: {Thousands: ` `, Decimal: `,`},
+	`ru`: {Thousands: ` `, Decimal: `,`},
+	`pl`: {Thousands: ` `, Decimal: `,`},
+	`cs`: {Thousands: ` `, Decimal: `,`},
+	`sv`: {Thousands: ` `, Decimal: `,`},
+	`fi`: {Thousands: ` `, Decimal: `,`},
+	`nb`: {Thousands: ` `, Decimal: `,`},
+	`ch`: {Thousands: `'`, Decimal: `.`},
+}
+
+// DefaultNumberLocale int/float 类型默认使用的数字格式。为空时自动识别千位分隔符和小数点
+var DefaultNumberLocale = ``
+
+// 数量级后缀对应的10的幂
+var numberMagnitudes = map[string]int{
+	`k`: 3, `千`: 3,
+	`w`: 4, `万`: 4, `萬`: 4,
+	`m`: 6, `百万`: 6, `百萬`: 6, `千万`: 7, `千萬`: 7,
+	`b`: 9, `bn`: 9,
+	`亿`: 8, `億`: 8, `万亿`: 12, `萬億`: 12,
+}
+
+var (
+	numberMagnitudeExp = regexp.MustCompile(`(?i)\s*(万亿|萬億|百万|百萬|千万|千萬|bn|[kmbw千万萬亿億])$`)
+	numberCurrencyExp  = regexp.MustCompile(`^(?:[A-Z]{2,3}\$|[A-Z]{3}|RMB|人民币|美元|欧元|日元|英镑|港币|港元|元|圆|块|[$¥￥€£₩₹₽฿₫₴₦₱₪¢])`)
+	numberCurrencyEnd  = regexp.MustCompile(`(?:[A-Z]{3}|RMB|人民币|美元|欧元|日元|英镑|港币|港元|元整?|圆整?|块钱?|[$¥￥€£₩₹₽฿₫₴₦₱₪¢])$`)
+	numberBodyExp      = regexp.MustCompile(`^(?:\d[\d,.' _]*|[.,]\d+)$`)
+	numberDecimalExp   = regexp.MustCompile(`^(?:\d+\.?\d*|\.\d+)$`)
+	numberExponentExp  = regexp.MustCompile(`^(?:\d+\.?\d*|\.\d+)[eE][-+]?\d+$`)
+	numberGroupingSpan = strings.NewReplacer("\u00a0", ` `, "\u202f", ` `, "\u2009", ` `, "\u2007", ` `, `’`, `'`)
+)
+
+func numberLocaleFormat(locale string) (NumberFormat, bool) {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if len(locale) == 0 || locale == `auto` {
+		return NumberFormat{}, false
+	}
+	if f, ok := NumberLocales[locale]; ok {
+		return f, true
+	}
+	if idx := strings.IndexAny(locale, `-_`); idx > 0 {
+		if f, ok := NumberLocales[locale[:idx]]; ok {
+			return f, true
+		}
+	}
+	return NumberFormat{}, false
+}
+
+// stripCurrency 去掉首尾的货币符号和货币代码
+func stripCurrency(s string) string {
+	for {
+		v := strings.TrimSpace(numberCurrencyExp.ReplaceAllString(s, ``))
+		v = strings.TrimSpace(numberCurrencyEnd.ReplaceAllString(v, ``))
+		if v == s {
+			return s
+		}
+		s = v
+	}
+}
+
+// ParseNumberString 将文本解析为标准格式的十进制数字字符串(例如 "-1234.5")，不会损失精度。
+// 支持货币符号、千位分隔符、不同地区的小数点、科学计数法、中文数字以及 万/亿/k/M 等数量级后缀。
+// locale 为空时自动识别千位分隔符和小数点
+func ParseNumberString(s string, locale string) (string, error) {
+	orig := s
+	s = numberGroupingSpan.Replace(strings.TrimSpace(_tosbc(s)))
+	s = stripCurrency(s)
+	var negative bool
+	if strings.HasPrefix(s, `(`) && strings.HasSuffix(s, `)`) { // 会计格式的负数
+		negative = true
+		s = strings.TrimSpace(stripCurrency(s[1 : len(s)-1]))
+	}
+	for _, sign := range []string{`-`, `−`, `–`, `负`, `+`} {
+		if strings.HasPrefix(s, sign) {
+			negative = negative || sign != `+`
+			s = strings.TrimSpace(stripCurrency(strings.TrimPrefix(s, sign)))
+			break
+		}
+	}
+	var exp int
+	chinese := isChineseNumber(s) // 中文数字自带数量级，例如：一千二百万
+	if m := numberMagnitudeExp.FindStringSubmatch(s); !chinese && m != nil && len(m[0]) < len(s) {
+		exp = numberMagnitudes[strings.ToLower(m[1])]
+		s = strings.TrimSpace(s[:len(s)-len(m[0])])
+	}
+	var (
+		number string
+		err    error
+	)
+	if chinese {
+		var v float64
+		v, err = ParseChineseNumber(s)
+		number = strconv.FormatFloat(v, 'f', -1, 64)
+	} else if numberExponentExp.MatchString(s) { // 科学计数法，例如：1.5e3、1e-7
+		var v float64
+		if v, err = strconv.ParseFloat(s, 64); err == nil {
+			number = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	} else {
+		number, err = normalizeDecimal(s, locale)
+	}
+	if err != nil {
+		return ``, fmt.Errorf("%w: %q", ErrInvalidNumber, orig)
+	}
+	number = shiftDecimal(number, exp)
+	if negative && strings.Trim(number, `0.`) != `` {
+		number = `-` + number
+	}
+	return number, nil
+}
+
+// normalizeDecimal 去掉千位分隔符并将小数点统一为“.”
+func normalizeDecimal(s string, locale string) (string, error) {
+	if !numberBodyExp.MatchString(s) {
+		return ``, ErrInvalidNumber
+	}
+	if f, ok := numberLocaleFormat(locale); ok {
+		if f.Thousands != ` ` {
+			s = strings.Replace(s, f.Thousands, ``, -1)
+		}
+		s = strings.NewReplacer(` `, ``, `_`, ``, `'`, ``).Replace(s)
+		s = strings.Replace(s, f.Decimal, `.`, 1)
+	} else {
+		s = strings.NewReplacer(` `, ``, `_`, ``, `'`, ``).Replace(s)
+		comma := strings.LastIndex(s, `,`)
+		dot := strings.LastIndex(s, `.`)
+		switch {
+		case comma >= 0 && dot >= 0: // 后出现的是小数点
+			if comma > dot {
+				s = strings.Replace(strings.Replace(s, `.`, ``, -1), `,`, `.`, 1)
+			} else {
+				s = strings.Replace(s, `,`, ``, -1)
+			}
+		case comma >= 0:
+			// 只有一个逗号且后面不是3位数字时作为小数点，例如：12,5
+			if strings.Count(s, `,`) == 1 && (len(s)-comma-1 != 3 || comma == 0 || s[0] == '0') {
+				s = strings.Replace(s, `,`, `.`, 1)
+			} else {
+				s = strings.Replace(s, `,`, ``, -1)
+			}
+		case dot >= 0:
+			if strings.Count(s, `.`) > 1 {
+				s = strings.Replace(s, `.`, ``, -1)
+			}
+		}
+	}
+	if !numberDecimalExp.MatchString(s) {
+		return ``, ErrInvalidNumber
+	}
+	return s, nil
+}
+
+// shiftDecimal 将十进制数字字符串乘以10的exp次幂，并去掉多余的0
+func shiftDecimal(s string, exp int) string {
+	intPart, fracPart := s, ``
+	if idx := strings.Index(s, `.`); idx >= 0 {
+		intPart, fracPart = s[:idx], s[idx+1:]
+	}
+	for ; exp > 0; exp-- {
+		if len(fracPart) > 0 {
+			intPart += fracPart[:1]
+			fracPart = fracPart[1:]
+		} else {
+			intPart += `0`
+		}
+	}
+	intPart = strings.TrimLeft(intPart, `0`)
+	if len(intPart) == 0 {
+		intPart = `0`
+	}
+	fracPart = strings.TrimRight(fracPart, `0`)
+	if len(fracPart) == 0 {
+		return intPart
+	}
+	return intPart + `.` + fracPart
+}
+
+// ParseNumber 将文本解析为浮点数，参见 ParseNumberString
+func ParseNumber(s string, locale string) (float64, error) {
+	number, err := ParseNumberString(s, locale)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(number, 64)
+}
+
+// ParseInteger 将文本解析为整数(小数部分会被舍去)，参见 ParseNumberString
+func ParseInteger(s string, locale string) (int64, error) {
+	number, err := ParseNumberString(s, locale)
+	if err != nil {
+		return 0, err
+	}
+	if idx := strings.Index(number, `.`); idx >= 0 {
+		number = number[:idx]
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidNumber, s)
+	}
+	return n, nil
+}
+
+var (
+	chineseDigits = map[rune]int{
+		'零': 0, '〇': 0, '一': 1, '壹': 1, '幺': 1, '二': 2, '贰': 2, '貳': 2, '两': 2, '兩': 2, '三': 3, '叁': 3, '參': 3,
+		'四': 4, '肆': 4, '五': 5, '伍': 5, '六': 6, '陆': 6, '陸': 6, '七': 7, '柒': 7, '八': 8, '捌': 8, '九': 9, '玖': 9,
+	}
+	chineseUnits = map[rune]float64{
+		'十': 10, '拾': 10, '百': 100, '佰': 100, '千': 1000, '仟': 1000,
+	}
+	chineseBigUnits = map[rune]float64{
+		'万': 1e4, '萬': 1e4, '亿': 1e8, '億': 1e8,
+	}
+)
+
+func isChineseNumber(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		if _, ok := chineseDigits[r]; ok {
+			continue
+		}
+		if _, ok := chineseUnits[r]; ok {
+			continue
+		}
+		if _, ok := chineseBigUnits[r]; ok {
+			continue
+		}
+		if r != '点' && r != '點' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseChineseNumber 将中文数字转换为数值。例如：一千二百三十四、壹万零五、三点一四、二〇二四
+func ParseChineseNumber(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	var negative bool
+	if strings.HasPrefix(s, `负`) {
+		negative = true
+		s = strings.TrimPrefix(s, `负`)
+	}
+	intPart, fracPart := s, ``
+	for _, point := range []string{`点`, `點`} {
+		if idx := strings.Index(s, point); idx >= 0 {
+			intPart, fracPart = s[:idx], s[idx+len(point):]
+			break
+		}
+	}
+	if len(intPart) == 0 || !isChineseNumber(intPart) {
+		return 0, ErrInvalidNumber
+	}
+	var total, section, num float64
+	var hasUnit, hasDigit bool
+	for i, r := range intPart {
+		if _, ok := chineseDigits[r]; ok {
+			hasDigit = true
+		} else if u, ok := chineseUnits[r]; ok {
+			hasUnit = true
+			hasDigit = hasDigit || (i == 0 && u == 10) // 例如：十、十五
+		} else if _, ok := chineseBigUnits[r]; ok {
+			if i == 0 { // 例如：万一
+				return 0, ErrInvalidNumber
+			}
+			hasUnit = true
+		}
+	}
+	if !hasDigit { // 例如：千万、百
+		return 0, ErrInvalidNumber
+	}
+	if !hasUnit { // 逐位读的数字，例如：二〇二四
+		for _, r := range intPart {
+			total = total*10 + float64(chineseDigits[r])
+		}
+	} else {
+		for _, r := range intPart {
+			if d, ok := chineseDigits[r]; ok {
+				num = float64(d)
+				continue
+			}
+			if u, ok := chineseUnits[r]; ok {
+				if num == 0 {
+					num = 1 // 例如：十五
+				}
+				section += num * u
+				num = 0
+				continue
+			}
+			if u, ok := chineseBigUnits[r]; ok {
+				if u >= 1e8 {
+					total = (total + section + num) * u
+				} else {
+					total += (section + num) * u
+				}
+				section, num = 0, 0
+			}
+		}
+		total += section + num
+	}
+	if len(fracPart) > 0 {
+		scale := 0.1
+		for _, r := range fracPart {
+			d, ok := chineseDigits[r]
+			if !ok {
+				return 0, ErrInvalidNumber
+			}
+			total += float64(d) * scale
+			scale /= 10
+		}
+		// 消除浮点数运算的误差
+		n := len([]rune(fracPart))
+		pow := math.Pow10(n)
+		total = math.Round(total*pow) / pow
+	}
+	if negative {
+		total = -total
+	}
+	return total, nil
+}
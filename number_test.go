@@ -0,0 +1,81 @@
+package gopiper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := map[string]string{
+		`1,234`:      `1234`,
+		`¥ 99.00`:    `99`,
+		`￥1,299.50元`: `1299.5`,
+		`US$1,000`:   `1000`,
+		`3.2万`:       `32000`,
+		`1.5k`:       `1500`,
+		`2.5M`:       `2500000`,
+		`1.2亿`:       `120000000`,
+		`12 345,67`:  `12345.67`,
+		`1.234.567`:  `1234567`,
+		`1.234,5`:    `1234.5`,
+		`12,5`:       `12.5`,
+		`-1,234.5`:   `-1234.5`,
+		`(1,234.00)`: `-1234`,
+		`€ 1'234.50`: `1234.5`,
+		`一千二百三十四`:    `1234`,
+		`一千二百万`:      `12000000`,
+		`三点一四`:       `3.14`,
+		`十五`:         `15`,
+		`壹万零五`:       `10005`,
+		`二〇二四`:       `2024`,
+		`１２３`:        `123`,
+		`0.5`:        `0.5`,
+		`.5`:         `0.5`,
+		`1.5e3`:      `1500`,
+		`1e-7`:       `0.0000001`,
+		`-2E+2`:      `-200`,
+		`十万`:         `100000`,
+	}
+	for input, expected := range tests {
+		v, err := ParseNumberString(input, ``)
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, expected, v, input)
+		}
+	}
+
+	for _, input := range []string{``, `abc`, `1.2.3,4,5`, `万`, `12abc`, `万一`, `千万`, `百`, `1e`} {
+		_, err := ParseNumberString(input, ``)
+		assert.True(t, errors.Is(err, ErrInvalidNumber), input)
+	}
+
+	v, err := ParseNumberString(`1.234`, `de`)
+	assert.NoError(t, err)
+	assert.Equal(t, `1234`, v)
+	v, err = ParseNumberString(`1 234,5`, `fr-FR`)
+	assert.NoError(t, err)
+	assert.Equal(t, `1234.5`, v)
+
+	n, err := ParseInteger(`¥ 99.90`, ``)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(99), n)
+}
+
+func TestNumberFilter(t *testing.T) {
+	pipe := &PipeItem{}
+	v, err := intval(pipe, `1,234`, ``)
+	assert.NoError(t, err)
+	assert.Equal(t, 1234, v)
+
+	v, err = floatval(pipe, `12.345,67`, `de`)
+	assert.NoError(t, err)
+	assert.Equal(t, 12345.67, v)
+
+	_, err = floatval(pipe, `N/A`, ``)
+	assert.Error(t, err)
+
+	v, err = text2float(`3.2万`)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(32000), v)
+}
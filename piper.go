@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/admpub/regexp2"
 
@@ -31,6 +32,16 @@ const (
 	PT_ARRAY        = "array"
 	PT_JSON_VALUE   = "json"
 	PT_JSON_PARSE   = "jsonparse"
+	PT_TABLE        = "table"
+	PT_JSONLD       = "jsonld"
+	PT_MICRODATA    = "microdata"
+	PT_RDFA         = "rdfa"
+	PT_OPENGRAPH    = "opengraph"
+	PT_READABILITY  = "readability"
+	PT_DATETIME     = "datetime"
+	PT_PRICE        = "price"
+	PT_COALESCE     = "coalesce"
+	PT_EXPR         = "expr"
 	// end new version
 
 	// begin compatible old version
@@ -52,8 +63,10 @@ const (
 	PAGE_XML  = "xml"
 	PAGE_TEXT = "text"
 
-	REGEXP_PRE  = "regexp:"
-	REGEXP2_PRE = "regexp2:"
+	REGEXP_PRE      = "regexp:"
+	REGEXP2_PRE     = "regexp2:"
+	REGEXP_ALL_PRE  = "regexpall:"
+	REGEXP2_ALL_PRE = "regexp2all:"
 )
 
 var (
@@ -65,24 +78,41 @@ var (
 
 // VerifySelector 验证正则表达式
 func VerifySelector(selector string) (err error) {
-	if strings.HasPrefix(selector, REGEXP_PRE) {
-		_, err = regexp.Compile(strings.TrimPrefix(selector, REGEXP_PRE))
-	} else if strings.HasPrefix(selector, REGEXP2_PRE) {
-		_, err = regexp2.Compile(strings.TrimPrefix(selector, REGEXP2_PRE), regexp2.RE2)
+	expr, useRegexp2, _, ok := regexpSelector(selector)
+	if !ok {
+		return
+	}
+	if useRegexp2 {
+		_, err = regexp2.Compile(expr, regexp2.RE2)
+	} else {
+		_, err = regexp.Compile(expr)
 	}
 	return
 }
 
 type PipeItem struct {
-	Name     string     `json:"name,omitempty"` //只有类型为map的时候才会用到
-	Selector string     `json:"selector,omitempty"`
-	Type     string     `json:"type"`
-	Filter   string     `json:"filter,omitempty"`
-	SubItem  []PipeItem `json:"subitem,omitempty"`
+	Name     string            `json:"name,omitempty"` //只有类型为map的时候才会用到
+	Selector string            `json:"selector,omitempty"`
+	Type     string            `json:"type"`
+	Filter   string            `json:"filter,omitempty"`
+	SubItem  []PipeItem        `json:"subitem,omitempty"`
+	Scripts  map[string]string `json:"scripts,omitempty"` //用JavaScript编写的过滤器(名称=>脚本)，当前规则及子规则中可用
 	fetcher  Fether
 	storer   Storer
 	pageType string
 	doc      *goquery.Document
+	trace    *TraceNode
+	node     *TraceNode
+	hooks    []Hook
+
+	regexpTimeout time.Duration
+	limits        *Limits
+	counter       *execCounter
+	depth         int
+	scope         *valueScope       // 可引用的字段(同一map中已提取的字段及上级map的字段)
+	scripts       map[string]string // 上级规则中定义的脚本过滤器
+	charset       string            // 页面编码
+	sandboxed     bool              // 在表达式中执行，禁止调用 exprDeniedFilters 中的过滤器
 }
 
 type Fether func(pageURL string) (body []byte, err error)
@@ -102,10 +132,25 @@ func (p *PipeItem) SetStorer(storer Storer) {
 	p.storer = storer
 }
 
+// SetTrace 设置跟踪树。执行时会将每个规则项的选择器匹配情况、原始值及各过滤器的处理结果记录到此树中
+func (p *PipeItem) SetTrace(trace *TraceNode) {
+	p.trace = trace
+}
+
 func (p *PipeItem) CopyFrom(from *PipeItem) {
 	p.SetFetcher(from.fetcher)
 	p.SetStorer(from.storer)
 	p.doc = from.doc
+	p.trace = from.node
+	p.hooks = from.hooks
+	p.regexpTimeout = from.regexpTimeout
+	p.limits = from.limits
+	p.counter = from.counter
+	p.depth = from.depth + 1
+	p.scope = from.scope
+	p.scripts = from.scriptFilters()
+	p.charset = from.charset
+	p.sandboxed = from.sandboxed
 }
 
 func (p *PipeItem) Fetcher() Fether {
@@ -116,8 +161,24 @@ func (p *PipeItem) Storer() Storer {
 	return p.storer
 }
 
-func (p *PipeItem) PipeBytes(body []byte, pageType string) (interface{}, error) {
+func (p *PipeItem) Trace() *TraceNode {
+	return p.trace
+}
+
+func (p *PipeItem) PipeBytes(body []byte, pageType string) (res interface{}, err error) {
+	if p.counter == nil { // 根规则
+		p.counter = &execCounter{}
+		defer func() {
+			if err == nil {
+				err = p.checkOutputSize(res)
+			}
+			p.counter = nil
+		}()
+	}
 	p.pageType = pageType
+	if body, err = p.decodeBody(body, pageType); err != nil {
+		return nil, err
+	}
 	switch pageType {
 	case PAGE_HTML:
 		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
@@ -136,46 +197,68 @@ func (p *PipeItem) PipeBytes(body []byte, pageType string) (interface{}, error)
 
 func (p *PipeItem) parseRegexp(body string, useRegexp2 bool) (interface{}, error) {
 	var (
-		preLen int
-		sv     []string
-		rs     string
+		sv      []string
+		rs      string
+		matches []*regexpMatch
 	)
+	s, _, all, _ := regexpSelector(p.Selector)
 	if useRegexp2 {
-		preLen = len(REGEXP2_PRE)
-	} else {
-		preLen = len(REGEXP_PRE)
-	}
-	s := p.Selector[preLen:]
-	if useRegexp2 {
-		exp, err := regexp2.Compile(s, regexp2.RE2)
+		exp, err := p.compileRegexp2(s)
 		if err != nil {
 			return nil, err
 		}
-		mch, err := exp.FindStringMatch(body)
-		if err != nil {
-			return nil, err
-		}
-		if mch != nil {
-			sv = mch.Slice()
-			//fmt.Println(`[regexp2][matched:`+strconv.Itoa(mch.GroupCount())+`]`, mch.String(), com.Dump(sv, false))
+		if all {
+			matches, err = findAllRegexp2(exp, body)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			mch, err := exp.FindStringMatch(body)
+			if err != nil {
+				return nil, regexp2Error(exp, err)
+			}
+			if mch != nil {
+				sv = mch.Slice()
+				matches = append(matches, newRegexp2Match(mch))
+				//fmt.Println(`[regexp2][matched:`+strconv.Itoa(mch.GroupCount())+`]`, mch.String(), com.Dump(sv, false))
+			}
 		}
 	} else {
 		exp, err := regexp.Compile(s)
 		if err != nil {
 			return nil, err
 		}
-		sv = exp.FindStringSubmatch(body)
+		if all {
+			matches = findAllRegexp(exp, body)
+		} else {
+			sv = exp.FindStringSubmatch(body)
+			if len(sv) > 0 {
+				matches = append(matches, newRegexpMatch(sv, exp.SubexpNames()))
+			}
+		}
 	}
 
-	if len(sv) == 1 {
+	if all {
+		sv = make([]string, len(matches))
+		for i, m := range matches {
+			sv[i] = m.value()
+		}
+		if len(sv) > 0 {
+			rs = sv[0]
+		}
+	} else if len(sv) == 1 {
 		rs = sv[0]
 	} else if len(sv) > 1 {
 		rs = sv[1]
 		sv = sv[1:]
 	}
 
+	if priceExp.MatchString(p.Type) {
+		return p.pipePrice(rs, priceExp.FindStringSubmatch(p.Type)[1])
+	}
+
 	switch p.Type {
-	case PT_INT, PT_FLOAT, PT_BOOL:
+	case PT_INT, PT_FLOAT, PT_BOOL, PT_DATETIME:
 		val, err := parseTextValue(rs, p.Type)
 		if err != nil {
 			return nil, err
@@ -213,17 +296,27 @@ func (p *PipeItem) parseRegexp(body string, useRegexp2 bool) (interface{}, error
 		}
 		return callFilter(p, res, p.Filter)
 	case PT_MAP:
+		var first *regexpMatch
+		if len(matches) > 0 {
+			first = matches[0]
+		}
+		return p.pipeRegexpMap(first, rs)
+	case PT_ARRAY:
 		if p.SubItem == nil || len(p.SubItem) <= 0 {
 			return nil, ErrArrayNeedSubItem
 		}
-		res := make(map[string]interface{})
-		for _, subitem := range p.SubItem {
-			if len(subitem.Name) == 0 {
-				continue
+		if err := p.checkArrayLength(len(matches)); err != nil {
+			return nil, err
+		}
+		arrayItem := p.SubItem[0]
+		arrayItem.CopyFrom(p)
+		res := make([]interface{}, 0, len(matches))
+		for _, m := range matches {
+			v, err := arrayItem.pipeRegexpMatch(m)
+			if isAbort(err) {
+				return nil, err
 			}
-			subitem.CopyFrom(p)
-			subitem.Name = replaceName(subitem.Name, res)
-			res[subitem.Name], _ = subitem.pipeText([]byte(rs))
+			res = append(res, v)
 		}
 		return callFilter(p, res, p.Filter)
 	case PT_RAW:
@@ -254,21 +347,24 @@ func replaceName(name string, data map[string]interface{}) string {
 	return name
 }
 
-func (p *PipeItem) pipeSelection(s *goquery.Selection) (interface{}, error) {
+func (p *PipeItem) pipeSelection(s *goquery.Selection) (res interface{}, err error) {
+	defer p.endItem(&res, &err)
+	if err = p.beginItem(); err != nil {
+		return nil, err
+	}
+	if p, err = p.resolveRefs(); err != nil {
+		return nil, err
+	}
 	if p.Type == PT_RAW {
 		return callFilter(p, p.Selector, p.Filter)
 	}
-	var (
-		sel = htmlSelector{s, "", p.Selector}
-		err error
-	)
-	if strings.HasPrefix(p.Selector, REGEXP_PRE) {
-		body, _ := sel.Html()
-		return p.parseRegexp(body, false)
+	if p.Type == PT_EXPR {
+		return p.pipeExpr()
 	}
-	if strings.HasPrefix(p.Selector, REGEXP2_PRE) {
+	sel := htmlSelector{s, "", p.Selector}
+	if _, useRegexp2, _, ok := regexpSelector(p.Selector); ok {
 		body, _ := sel.Html()
-		return p.parseRegexp(body, true)
+		return p.parseRegexp(body, useRegexp2)
 	}
 	selector := p.Selector
 	if len(selector) > 0 {
@@ -303,8 +399,29 @@ func (p *PipeItem) pipeSelection(s *goquery.Selection) (interface{}, error) {
 		return callFilter(p, res, p.Filter)
 	}
 
+	if tableExp.MatchString(p.Type) { // 例如：table 或 table[1] 等
+		vt := tableExp.FindStringSubmatch(p.Type)
+		return p.pipeTable(sel.Selection, vt[1])
+	}
+	if structuredExp.MatchString(p.Type) { // 例如：jsonld 或 microdata[Product] 等
+		vt := structuredExp.FindStringSubmatch(p.Type)
+		return p.pipeStructured(sel.Selection, vt[1], vt[2])
+	}
+	if readabilityExp.MatchString(p.Type) { // 例如：readability 或 readability[text] 等
+		vt := readabilityExp.FindStringSubmatch(p.Type)
+		return p.pipeReadability(sel.Selection, vt[1])
+	}
+	if priceExp.MatchString(p.Type) { // 例如：price 或 price[USD] 等
+		vt := priceExp.FindStringSubmatch(p.Type)
+		text, err := getHTMLAttr(sel.Selection, sel.attr, sel.selector)
+		if err != nil {
+			return nil, err
+		}
+		return p.pipePrice(text, vt[1])
+	}
+
 	switch p.Type {
-	case PT_INT, PT_FLOAT, PT_BOOL, PT_STRING, PT_TEXT, PT_INT_ARRAY, PT_FLOAT_ARRAY, PT_BOOL_ARRAY, PT_STRING_ARRAY:
+	case PT_INT, PT_FLOAT, PT_BOOL, PT_STRING, PT_TEXT, PT_DATETIME, PT_INT_ARRAY, PT_FLOAT_ARRAY, PT_BOOL_ARRAY, PT_STRING_ARRAY:
 		val, err := parseHTMLAttr(sel, p.Type)
 		if err != nil {
 			return nil, err
@@ -356,29 +473,53 @@ func (p *PipeItem) pipeSelection(s *goquery.Selection) (interface{}, error) {
 		if p.SubItem == nil || len(p.SubItem) <= 0 {
 			return nil, ErrArrayNeedSubItem
 		}
+		if err = p.checkArrayLength(sel.Size()); err != nil {
+			return nil, err
+		}
 		arrayItem := p.SubItem[0]
 		arrayItem.CopyFrom(p)
 		res := make([]interface{}, 0)
-		sel.Each(func(index int, child *goquery.Selection) {
-			v, _ := arrayItem.pipeSelection(child)
+		sel.EachWithBreak(func(index int, child *goquery.Selection) bool {
+			var v interface{}
+			v, err = arrayItem.pipeSelection(child)
+			if isAbort(err) {
+				return false
+			}
 			res = append(res, v)
+			return true
 		})
+		if isAbort(err) {
+			return nil, err
+		}
 		return callFilter(p, res, p.Filter)
 	case PT_MAP:
 		if p.SubItem == nil || len(p.SubItem) <= 0 {
 			return nil, ErrArrayNeedSubItem
 		}
 		res := make(map[string]interface{})
-		for _, subitem := range p.SubItem {
+		subitems, err := orderSubItems(p.SubItem)
+		if err != nil {
+			return nil, err
+		}
+		for _, subitem := range subitems {
 			if len(subitem.Name) == 0 {
 				continue
 			}
 			subitem.CopyFrom(p)
 			subitem.Name = replaceName(subitem.Name, res)
-			res[subitem.Name], _ = subitem.pipeSelection(sel.Selection)
+			subitem.scope = p.scope.child(res)
+			var err error
+			res[subitem.Name], err = subitem.pipeSelection(sel.Selection)
+			if isAbort(err) {
+				return nil, err
+			}
 		}
 
 		return callFilter(p, res, p.Filter)
+	case PT_COALESCE:
+		return p.pipeCoalesce(func(subitem *PipeItem) (interface{}, error) {
+			return subitem.pipeSelection(sel.Selection)
+		})
 	default:
 		return callFilter(p, 0, p.Filter)
 	}
@@ -408,10 +549,13 @@ func (p *PipeItem) parseHTMLSelector(s *goquery.Selection, selector string) (htm
 	subs := SplitParams(selector, `|`)
 	leng := len(subs)
 	if leng < 2 {
-		return htmlSelector{s.Find(selector), attr, selector}, nil
+		s = s.Find(selector)
+		p.node.addStep("find", selector, s.Size())
+		return htmlSelector{s, attr, selector}, nil
 	}
 	subs[0] = strings.TrimSpace(subs[0])
 	s = s.Find(subs[0])
+	p.node.addStep("find", subs[0], s.Size())
 	for i := 1; i < leng; i++ {
 		subs[i] = strings.TrimSpace(subs[i])
 		if !fnExp.MatchString(subs[i]) {
@@ -498,6 +642,7 @@ func (p *PipeItem) parseHTMLSelector(s *goquery.Selection, selector string) (htm
 				return htmlSelector{s, `attr[` + params + `]`, selector}, nil
 			}
 		}
+		p.node.addStep(fn, params, s.Size())
 	}
 	return htmlSelector{s, attr, selector}, nil
 }
@@ -510,13 +655,15 @@ func parseTextValue(text interface{}, tp string) (interface{}, error) {
 		return text2float(text)
 	case PT_BOOL, PT_BOOL_ARRAY:
 		return text2bool(text)
+	case PT_DATETIME:
+		return text2datetime(text)
 	}
 	return text, nil
 }
 
 func parseHTMLAttr(sel htmlSelector, tp string) (interface{}, error) {
 	switch tp {
-	case PT_INT, PT_FLOAT, PT_BOOL, PT_TEXT, PT_STRING:
+	case PT_INT, PT_FLOAT, PT_BOOL, PT_TEXT, PT_STRING, PT_DATETIME:
 		text, err := getHTMLAttr(sel.Selection, sel.attr, sel.selector)
 		if err != nil {
 			return nil, err
@@ -633,10 +780,20 @@ func parseJSONSelector(js *simplejson.Json, selector string) (*simplejson.Json,
 	return js, nil
 }
 
-func (p *PipeItem) pipeJSON(body []byte) (interface{}, error) {
+func (p *PipeItem) pipeJSON(body []byte) (res interface{}, err error) {
+	defer p.endItem(&res, &err)
+	if err = p.beginItem(); err != nil {
+		return nil, err
+	}
+	if p, err = p.resolveRefs(); err != nil {
+		return nil, err
+	}
 	if p.Type == PT_RAW {
 		return callFilter(p, p.Selector, p.Filter)
 	}
+	if p.Type == PT_EXPR {
+		return p.pipeExpr()
+	}
 	js, err := simplejson.NewJson(body)
 	if err != nil {
 		return nil, err
@@ -649,15 +806,39 @@ func (p *PipeItem) pipeJSON(body []byte) (interface{}, error) {
 		}
 	}
 
+	if priceExp.MatchString(p.Type) {
+		return p.pipePrice(fmt.Sprint(js.Interface()), priceExp.FindStringSubmatch(p.Type)[1])
+	}
+
 	switch p.Type {
 	case PT_INT:
+		if str, err := js.String(); err == nil { // 例如："1,234"
+			val, err := text2int(str)
+			if err != nil {
+				return nil, err
+			}
+			return callFilter(p, val, p.Filter)
+		}
 		return callFilter(p, js.MustInt64(0), p.Filter)
 	case PT_FLOAT:
+		if str, err := js.String(); err == nil {
+			val, err := text2float(str)
+			if err != nil {
+				return nil, err
+			}
+			return callFilter(p, val, p.Filter)
+		}
 		return callFilter(p, js.MustFloat64(0.0), p.Filter)
 	case PT_BOOL:
 		return callFilter(p, js.MustBool(false), p.Filter)
 	case PT_TEXT, PT_STRING:
 		return callFilter(p, js.MustString(""), p.Filter)
+	case PT_DATETIME:
+		val, err := parseTextValue(fmt.Sprint(js.Interface()), p.Type)
+		if err != nil {
+			return nil, err
+		}
+		return callFilter(p, val, p.Filter)
 	case PT_TEXT_ARRAY, PT_STRING_ARRAY:
 		v, err := js.StringArray()
 		if err != nil {
@@ -694,12 +875,18 @@ func (p *PipeItem) pipeJSON(body []byte) (interface{}, error) {
 		if p.SubItem == nil || len(p.SubItem) <= 0 {
 			return nil, ErrArrayNeedSubItem
 		}
+		if err = p.checkArrayLength(len(v)); err != nil {
+			return nil, err
+		}
 		arrayItem := p.SubItem[0]
 		arrayItem.CopyFrom(p)
 		res := make([]interface{}, 0)
 		for _, r := range v {
 			data, _ := json.Marshal(r)
-			vl, _ := arrayItem.pipeJSON(data)
+			vl, err := arrayItem.pipeJSON(data)
+			if isAbort(err) {
+				return nil, err
+			}
 			res = append(res, vl)
 		}
 		return callFilter(p, res, p.Filter)
@@ -709,35 +896,60 @@ func (p *PipeItem) pipeJSON(body []byte) (interface{}, error) {
 		}
 		data, _ := json.Marshal(js)
 		res := make(map[string]interface{})
-		for _, subitem := range p.SubItem {
+		subitems, err := orderSubItems(p.SubItem)
+		if err != nil {
+			return nil, err
+		}
+		for _, subitem := range subitems {
 			if len(subitem.Name) == 0 {
 				continue
 			}
 			subitem.CopyFrom(p)
 			subitem.Name = replaceName(subitem.Name, res)
-			res[subitem.Name], _ = subitem.pipeJSON(data)
+			subitem.scope = p.scope.child(res)
+			var err error
+			res[subitem.Name], err = subitem.pipeJSON(data)
+			if isAbort(err) {
+				return nil, err
+			}
 		}
 
 		return callFilter(p, res, p.Filter)
+	case PT_COALESCE:
+		data, _ := json.Marshal(js)
+		return p.pipeCoalesce(func(subitem *PipeItem) (interface{}, error) {
+			return subitem.pipeJSON(data)
+		})
 	default:
 		return callFilter(p, 0, p.Filter)
 	}
 }
 
-func (p *PipeItem) pipeText(body []byte) (interface{}, error) {
+func (p *PipeItem) pipeText(body []byte) (res interface{}, err error) {
+	defer p.endItem(&res, &err)
+	if err = p.beginItem(); err != nil {
+		return nil, err
+	}
+	if p, err = p.resolveRefs(); err != nil {
+		return nil, err
+	}
 	if p.Type == PT_RAW {
 		return callFilter(p, p.Selector, p.Filter)
 	}
+	if p.Type == PT_EXPR {
+		return p.pipeExpr()
+	}
 	bodyStr := string(body)
-	if strings.HasPrefix(p.Selector, REGEXP_PRE) {
-		return p.parseRegexp(bodyStr, false)
+	if _, useRegexp2, _, ok := regexpSelector(p.Selector); ok {
+		return p.parseRegexp(bodyStr, useRegexp2)
 	}
-	if strings.HasPrefix(p.Selector, REGEXP2_PRE) {
-		return p.parseRegexp(bodyStr, true)
+
+	if priceExp.MatchString(p.Type) {
+		return p.pipePrice(bodyStr, priceExp.FindStringSubmatch(p.Type)[1])
 	}
 
 	switch p.Type {
-	case PT_INT, PT_FLOAT, PT_BOOL:
+	case PT_INT, PT_FLOAT, PT_BOOL, PT_DATETIME:
 		val, err := parseTextValue(bodyStr, p.Type)
 		if err != nil {
 			return nil, err
@@ -771,14 +983,29 @@ func (p *PipeItem) pipeText(body []byte) (interface{}, error) {
 			return nil, ErrArrayNeedSubItem
 		}
 		res := make(map[string]interface{})
-		for _, subitem := range p.SubItem {
+		subitems, err := orderSubItems(p.SubItem)
+		if err != nil {
+			return nil, err
+		}
+		for _, subitem := range subitems {
 			if len(subitem.Name) == 0 {
 				continue
 			}
+			// 与 html/json 的 map 一样传递本次执行的状态(跟踪树、fetch、限制等)，子规则的跟踪记录才会位于当前节点下
+			subitem.CopyFrom(p)
 			subitem.Name = replaceName(subitem.Name, res)
-			res[subitem.Name], _ = subitem.pipeText(body)
+			subitem.scope = p.scope.child(res)
+			var err error
+			res[subitem.Name], err = subitem.pipeText(body)
+			if isAbort(err) {
+				return nil, err
+			}
 		}
 		return callFilter(p, res, p.Filter)
+	case PT_COALESCE:
+		return p.pipeCoalesce(func(subitem *PipeItem) (interface{}, error) {
+			return subitem.pipeText(body)
+		})
 	default:
 		return callFilter(p, 0, p.Filter)
 	}
@@ -787,11 +1014,11 @@ func (p *PipeItem) pipeText(body []byte) (interface{}, error) {
 func text2int(text interface{}) (interface{}, error) {
 	switch val := text.(type) {
 	case string:
-		return strconv.ParseInt(val, 10, 64)
+		return ParseInteger(val, DefaultNumberLocale)
 	case []string:
 		vs := make([]int64, 0)
 		for _, v := range val {
-			n, err := strconv.ParseInt(v, 10, 64)
+			n, err := ParseInteger(v, DefaultNumberLocale)
 			if err != nil {
 				return nil, err
 			}
@@ -805,11 +1032,11 @@ func text2int(text interface{}) (interface{}, error) {
 func text2float(text interface{}) (interface{}, error) {
 	switch val := text.(type) {
 	case string:
-		return strconv.ParseFloat(val, 64)
+		return ParseNumber(val, DefaultNumberLocale)
 	case []string:
 		vs := make([]float64, 0)
 		for _, v := range val {
-			n, err := strconv.ParseFloat(v, 64)
+			n, err := ParseNumber(v, DefaultNumberLocale)
 			if err != nil {
 				return nil, err
 			}
@@ -0,0 +1,192 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// price / price[USD]
+var priceExp = regexp.MustCompile(`^` + PT_PRICE + `(?:\[([A-Za-z]{3})\])?$`)
+
+// DefaultCurrency 无法从文本中识别货币时使用的货币代码(ISO 4217)
+var DefaultCurrency = ``
+
+// CurrencyCodes 支持识别的 ISO 4217 货币代码
+var CurrencyCodes = map[string]bool{
+	`CNY`: true, `USD`: true, `EUR`: true, `JPY`: true, `GBP`: true, `HKD`: true, `TWD`: true, `MOP`: true,
+	`KRW`: true, `SGD`: true, `AUD`: true, `NZD`: true, `CAD`: true, `CHF`: true, `SEK`: true, `NOK`: true,
+	`DKK`: true, `PLN`: true, `CZK`: true, `HUF`: true, `RUB`: true, `UAH`: true, `TRY`: true, `INR`: true,
+	`IDR`: true, `MYR`: true, `THB`: true, `VND`: true, `PHP`: true, `BRL`: true, `MXN`: true, `ARS`: true,
+	`CLP`: true, `COP`: true, `ZAR`: true, `NGN`: true, `EGP`: true, `ILS`: true, `AED`: true, `SAR`: true,
+	`QAR`: true, `KWD`: true, `PKR`: true, `BDT`: true, `LKR`: true, `KZT`: true, `ISK`: true, `RON`: true,
+}
+
+// CurrencySymbols 货币符号对应的货币代码。有多个候选货币时，第一个为默认值，
+// 如果默认货币是候选货币之一则使用默认货币(例如默认货币为JPY时“¥”识别为JPY)
+var CurrencySymbols = map[string][]string{
+	`US$`: {`USD`}, `HK$`: {`HKD`}, `NT$`: {`TWD`}, `C$`: {`CAD`}, `CA$`: {`CAD`}, `A$`: {`AUD`}, `AU$`: {`AUD`},
+	`NZ$`: {`NZD`}, `S$`: {`SGD`}, `R$`: {`BRL`}, `MX$`: {`MXN`}, `CN¥`: {`CNY`}, `JP¥`: {`JPY`}, `RMB`: {`CNY`},
+	`$`: {`USD`, `CAD`, `AUD`, `NZD`, `SGD`, `HKD`, `TWD`, `MXN`, `ARS`, `CLP`, `COP`},
+	`¥`: {`CNY`, `JPY`}, `￥`: {`CNY`, `JPY`}, `円`: {`JPY`}, `€`: {`EUR`}, `£`: {`GBP`}, `₩`: {`KRW`},
+	`₹`: {`INR`}, `₽`: {`RUB`}, `฿`: {`THB`}, `₫`: {`VND`}, `₴`: {`UAH`}, `₦`: {`NGN`}, `₱`: {`PHP`},
+	`₪`: {`ILS`}, `₺`: {`TRY`}, `zł`: {`PLN`}, `Kč`: {`CZK`}, `kr`: {`SEK`, `NOK`, `DKK`, `ISK`}, `Fr.`: {`CHF`},
+	`人民币`: {`CNY`}, `元`: {`CNY`}, `块`: {`CNY`}, `美元`: {`USD`}, `美金`: {`USD`}, `欧元`: {`EUR`},
+	`日元`: {`JPY`}, `英镑`: {`GBP`}, `港币`: {`HKD`}, `港元`: {`HKD`}, `新台币`: {`TWD`}, `韩元`: {`KRW`},
+}
+
+var (
+	priceNumberExp   = regexp.MustCompile(`\d+(?:[,.'\x{a0}\x{202f} ]\d+)*(?:\s*(?:万|亿|[kK]\b))?`)
+	priceCodeExp     = regexp.MustCompile(`\b[A-Z]{3}\b`)
+	priceNegativeExp = regexp.MustCompile(`[-−]\s*(?:[A-Za-z]{0,3}[$¥￥€£₩₹₽฿₫₴₦₱₪])?\s*$`)
+)
+
+// Price 价格
+type Price struct {
+	Amount   json.Number `json:"amount"`   // 金额(十进制数字字符串，不会损失精度)
+	Currency string      `json:"currency"` // ISO 4217 货币代码，无法识别时为空
+	Raw      string      `json:"raw"`      // 原始文本
+}
+
+func (p *Price) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"amount":   p.Amount,
+		"currency": p.Currency,
+		"raw":      p.Raw,
+	}
+}
+
+// ParsePrice 从文本中提取价格。例如：US$1,299.99、€ 12,50、￥88起。
+// defaultCurrency 为空时使用 DefaultCurrency
+func ParsePrice(s string, defaultCurrency string) (*Price, error) {
+	if len(defaultCurrency) == 0 {
+		defaultCurrency = DefaultCurrency
+	}
+	defaultCurrency = strings.ToUpper(defaultCurrency)
+	raw := strings.TrimSpace(s)
+	text := _tosbc(raw)
+	loc := priceNumberExp.FindStringIndex(text)
+	if loc == nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidNumber, raw)
+	}
+	amount, err := ParseNumberString(text[loc[0]:loc[1]], DefaultNumberLocale)
+	if err != nil {
+		return nil, err
+	}
+	if priceNegativeExp.MatchString(text[:loc[0]]) {
+		amount = `-` + amount
+	}
+	currency := detectCurrency(text[:loc[0]], text[loc[1]:], defaultCurrency)
+	if len(currency) == 0 {
+		currency = defaultCurrency
+	}
+	return &Price{Amount: json.Number(amount), Currency: currency, Raw: raw}, nil
+}
+
+// detectCurrency 识别金额前后文本中的货币。优先使用紧邻金额的货币代码或货币符号，
+// 例如 "TRY NOW $10" 识别为 "$" 而不是 TRY
+func detectCurrency(before string, after string, defaultCurrency string) string {
+	before = strings.TrimRightFunc(before, unicode.IsSpace)
+	after = strings.TrimLeftFunc(after, unicode.IsSpace)
+	matched := adjacentCurrency(before, true)
+	if len(matched) == 0 {
+		matched = adjacentCurrency(after, false)
+	}
+	if len(matched) == 0 {
+		matched = findCurrency(before + ` ` + after)
+	}
+	if len(matched) == 0 {
+		return ``
+	}
+	candidates, ok := CurrencySymbols[matched]
+	if !ok {
+		return matched // 货币代码
+	}
+	for _, code := range candidates {
+		if code == defaultCurrency {
+			return code
+		}
+	}
+	return candidates[0]
+}
+
+// adjacentCurrency 返回位于 text 末尾(atEnd 为 true)或开头的货币代码或货币符号(优先匹配较长的)
+func adjacentCurrency(text string, atEnd bool) string {
+	var matched string
+	check := func(symbol string) {
+		if len(symbol) <= len(matched) {
+			return
+		}
+		if atEnd {
+			if strings.HasSuffix(text, symbol) && currencyBoundary(text, len(text)-len(symbol), len(text)) {
+				matched = symbol
+			}
+		} else if strings.HasPrefix(text, symbol) && currencyBoundary(text, 0, len(symbol)) {
+			matched = symbol
+		}
+	}
+	for code := range CurrencyCodes {
+		check(code)
+	}
+	for symbol := range CurrencySymbols {
+		check(symbol)
+	}
+	return matched
+}
+
+// findCurrency 在 text 中查找货币代码或货币符号(货币代码优先，货币符号优先匹配较长的)
+func findCurrency(text string) string {
+	for _, code := range priceCodeExp.FindAllString(text, -1) {
+		if CurrencyCodes[code] {
+			return code
+		}
+	}
+	var matched string
+	for symbol := range CurrencySymbols {
+		if len(symbol) < len(matched) || (len(symbol) == len(matched) && symbol > matched) || !containsCurrency(text, symbol) {
+			continue
+		}
+		matched = symbol
+	}
+	return matched
+}
+
+func containsCurrency(text string, symbol string) bool {
+	for offset := 0; offset < len(text); {
+		idx := strings.Index(text[offset:], symbol)
+		if idx < 0 {
+			return false
+		}
+		idx += offset
+		if currencyBoundary(text, idx, idx+len(symbol)) {
+			return true
+		}
+		offset = idx + 1
+	}
+	return false
+}
+
+// currencyBoundary 以字母开头或结尾的货币代码(例如 kr、RMB)前后不能紧接字母
+func currencyBoundary(text string, start int, end int) bool {
+	if isASCIILetter(text[start]) && start > 0 && isASCIILetter(text[start-1]) {
+		return false
+	}
+	if isASCIILetter(text[end-1]) && end < len(text) && isASCIILetter(text[end]) {
+		return false
+	}
+	return true
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (p *PipeItem) pipePrice(text string, defaultCurrency string) (interface{}, error) {
+	price, err := ParsePrice(text, defaultCurrency)
+	if err != nil {
+		return nil, err
+	}
+	return callFilter(p, price.Map(), p.Filter)
+}
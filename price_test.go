@@ -0,0 +1,63 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := map[string][2]string{
+		`US$1,299.99`:            {`1299.99`, `USD`},
+		`€ 12,50`:                {`12.5`, `EUR`},
+		`￥88起`:                   {`88`, `CNY`},
+		`1 234,56 EUR`:           {`1234.56`, `EUR`},
+		`HK$ 1,000`:              {`1000`, `HKD`},
+		`售价：199元`:                {`199`, `CNY`},
+		`3.5万美元`:                 {`35000`, `USD`},
+		`£0.10`:                  {`0.1`, `GBP`},
+		`-$5.00`:                 {`-5`, `USD`},
+		`Price: 19.99`:           {`19.99`, ``},
+		`0.1 + 0.2 USD`:          {`0.1`, `USD`},
+		`TRY NOW $10`:            {`10`, `USD`},
+		`Save 20 EUR, total $99`: {`20`, `EUR`},
+		`99 kr`:                  {`99`, `SEK`},
+		`Kraken 99`:              {`99`, ``},
+		`Bookrack 5`:             {`5`, ``},
+	}
+	for input, expected := range tests {
+		price, err := ParsePrice(input, ``)
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, json.Number(expected[0]), price.Amount, input)
+			assert.Equal(t, expected[1], price.Currency, input)
+			assert.Equal(t, input, price.Raw)
+		}
+	}
+
+	price, err := ParsePrice(`¥1,200`, `JPY`)
+	assert.NoError(t, err)
+	assert.Equal(t, `JPY`, price.Currency)
+
+	price, err = ParsePrice(`19.99`, `usd`)
+	assert.NoError(t, err)
+	assert.Equal(t, `USD`, price.Currency)
+
+	_, err = ParsePrice(`面议`, ``)
+	assert.Error(t, err)
+}
+
+func TestPriceType(t *testing.T) {
+	body := []byte(`<div class="price">US$1,299.99</div><div class="sale">12.00</div>`)
+	p := PipeItem{
+		Type: PT_MAP,
+		SubItem: []PipeItem{
+			{Name: "price", Selector: ".price", Type: "price"},
+			{Name: "sale", Selector: ".sale", Type: "price[EUR]"},
+		},
+	}
+	v, err := p.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	b, _ := json.Marshal(v)
+	assert.Equal(t, `{"price":{"amount":1299.99,"currency":"USD","raw":"US$1,299.99"},"sale":{"amount":12,"currency":"EUR","raw":"12.00"}}`, string(b))
+}
@@ -0,0 +1,362 @@
+package gopiper
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// readability / readability[html] / readability[text]
+var readabilityExp = regexp.MustCompile(`^` + PT_READABILITY + `(?:\[(html|text)\])?$`)
+
+var (
+	readabilityUnlikelyExp = regexp.MustCompile(`(?i)-ad-|ai2html|banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote`)
+	readabilityMaybeExp    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	readabilityPositiveExp = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	readabilityNegativeExp = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+	readabilityBylineExp   = regexp.MustCompile(`(?i)byline|author|dateline|writtenby|p-author`)
+)
+
+// Readability 正文提取的结果
+type Readability struct {
+	Title   string `json:"title"`
+	Byline  string `json:"byline"`
+	Image   string `json:"image"`
+	Content string `json:"content"` // 正文HTML
+	Text    string `json:"text"`    // 正文纯文本
+}
+
+func (r *Readability) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"title":   r.Title,
+		"byline":  r.Byline,
+		"image":   r.Image,
+		"content": r.Content,
+		"text":    r.Text,
+	}
+}
+
+// pipeReadability 按文本密度、链接密度以及class/id特征为节点打分，提取正文
+func (p *PipeItem) pipeReadability(sel *goquery.Selection, output string) (interface{}, error) {
+	r, err := ParseReadability(sel)
+	if err != nil {
+		return nil, err
+	}
+	switch output {
+	case `html`:
+		return callFilter(p, r.Content, p.Filter)
+	case `text`:
+		return callFilter(p, r.Text, p.Filter)
+	}
+	return callFilter(p, r.Map(), p.Filter)
+}
+
+// ParseReadability 提取正文、标题、作者和主图。不会修改传入的 sel
+func ParseReadability(sel *goquery.Selection) (*Readability, error) {
+	var src string
+	var err error
+	if sel.Length() > 0 && sel.Get(0).Type == html.DocumentNode {
+		src, err = sel.Html()
+	} else {
+		src, err = goquery.OuterHtml(sel.First())
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	r := &Readability{
+		Title:  readabilityTitle(doc),
+		Byline: readabilityByline(doc),
+		Image:  readabilityMeta(doc, `og:image`, `twitter:image`),
+	}
+	content := readabilityGrab(doc)
+	if content == nil {
+		return r, nil
+	}
+	content.Find(`h1`).Each(func(_ int, s *goquery.Selection) {
+		if normalizeSpace(s.Text()) == r.Title {
+			s.Remove()
+		}
+	})
+	if len(r.Image) == 0 {
+		r.Image = content.Find(`img[src]`).First().AttrOr(`src`, ``)
+	}
+	r.Content, _ = content.Html()
+	r.Content = strings.TrimSpace(r.Content)
+	r.Text = readabilityText(content)
+	return r, nil
+}
+
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func readabilityMeta(doc *goquery.Document, names ...string) string {
+	for _, name := range names {
+		v := doc.Find(`meta[property="`+name+`"],meta[name="`+name+`"]`).First().AttrOr(`content`, ``)
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			return v
+		}
+	}
+	return ``
+}
+
+func readabilityTitle(doc *goquery.Document) string {
+	if title := readabilityMeta(doc, `og:title`, `twitter:title`); len(title) > 0 {
+		return title
+	}
+	if h1 := doc.Find(`h1`); h1.Length() == 1 {
+		if title := normalizeSpace(h1.Text()); len(title) > 0 {
+			return title
+		}
+	}
+	title := normalizeSpace(doc.Find(`title`).First().Text())
+	for _, sep := range []string{` | `, ` - `, ` _ `, ` – `, ` — `} {
+		if idx := strings.LastIndex(title, sep); idx > 0 {
+			return strings.TrimSpace(title[:idx])
+		}
+	}
+	return title
+}
+
+func readabilityByline(doc *goquery.Document) string {
+	if byline := readabilityMeta(doc, `author`, `article:author`); len(byline) > 0 && !strings.HasPrefix(byline, `http`) {
+		return byline
+	}
+	var byline string
+	doc.Find(`[rel="author"],[itemprop~="author"],[class],[id]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		rel, _ := s.Attr(`rel`)
+		itemprop, _ := s.Attr(`itemprop`)
+		if rel != `author` && !strings.Contains(itemprop, `author`) && !readabilityBylineExp.MatchString(s.AttrOr(`class`, ``)+` `+s.AttrOr(`id`, ``)) {
+			return true
+		}
+		text := normalizeSpace(s.Text())
+		if len(text) > 0 && len(text) < 100 {
+			byline = text
+			return false
+		}
+		return true
+	})
+	return byline
+}
+
+func classWeight(s *goquery.Selection) float64 {
+	var weight float64
+	for _, attr := range []string{`class`, `id`} {
+		v := s.AttrOr(attr, ``)
+		if len(v) == 0 {
+			continue
+		}
+		if readabilityNegativeExp.MatchString(v) {
+			weight -= 25
+		}
+		if readabilityPositiveExp.MatchString(v) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+func linkDensity(s *goquery.Selection) float64 {
+	textLength := len(normalizeSpace(s.Text()))
+	if textLength == 0 {
+		return 0
+	}
+	var linkLength int
+	s.Find(`a`).Each(func(_ int, a *goquery.Selection) {
+		linkLength += len(normalizeSpace(a.Text()))
+	})
+	return float64(linkLength) / float64(textLength)
+}
+
+func tagWeight(tag string) float64 {
+	switch tag {
+	case `div`, `article`, `section`, `main`:
+		return 5
+	case `pre`, `td`, `blockquote`:
+		return 3
+	case `address`, `ol`, `ul`, `dl`, `dd`, `dt`, `li`, `form`:
+		return -3
+	case `h1`, `h2`, `h3`, `h4`, `h5`, `h6`, `th`:
+		return -5
+	}
+	return 0
+}
+
+// readabilityGrab 返回得分最高的节点及其相关的兄弟节点
+func readabilityGrab(doc *goquery.Document) *goquery.Selection {
+	doc.Find(`script,style,noscript,iframe,form,nav,aside,footer,link,object,embed,button,input,select,textarea`).Remove()
+	// 包含 article 或 main 的节点
+	containers := map[*html.Node]bool{}
+	doc.Find(`article,main`).Parents().Each(func(_ int, s *goquery.Selection) {
+		containers[s.Get(0)] = true
+	})
+	doc.Find(`*`).Each(func(_ int, s *goquery.Selection) {
+		tag := goquery.NodeName(s)
+		if tag == `body` || tag == `html` || tag == `article` || tag == `main` || containers[s.Get(0)] {
+			return
+		}
+		match := s.AttrOr(`class`, ``) + ` ` + s.AttrOr(`id`, ``)
+		if readabilityUnlikelyExp.MatchString(match) && !readabilityMaybeExp.MatchString(match) {
+			s.Remove()
+		}
+	})
+
+	scores := map[*html.Node]float64{}
+	var candidates []*goquery.Selection
+	initialize := func(s *goquery.Selection) {
+		node := s.Get(0)
+		if _, ok := scores[node]; ok {
+			return
+		}
+		scores[node] = tagWeight(goquery.NodeName(s)) + classWeight(s)
+		candidates = append(candidates, s)
+	}
+	doc.Find(`p,pre,td,section,div`).Each(func(_ int, s *goquery.Selection) {
+		tag := goquery.NodeName(s)
+		if (tag == `div` || tag == `section`) && s.Find(`p,div,section,table,ul,ol,pre,blockquote`).Length() > 0 {
+			return
+		}
+		text := normalizeSpace(s.Text())
+		if len([]rune(text)) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, `,`)+strings.Count(text, `，`))
+		score += math.Min(float64(len([]rune(text))/100), 3)
+		parent := s.Parent()
+		if parent.Length() == 0 {
+			return
+		}
+		initialize(parent)
+		scores[parent.Get(0)] += score
+		if grand := parent.Parent(); grand.Length() > 0 && grand.Get(0).Type == html.ElementNode {
+			initialize(grand)
+			scores[grand.Get(0)] += score / 2
+		}
+	})
+	if len(candidates) == 0 {
+		body := doc.Find(`body`)
+		if body.Length() == 0 {
+			return nil
+		}
+		return body
+	}
+
+	var top *goquery.Selection
+	var topScore float64
+	for _, c := range candidates {
+		score := scores[c.Get(0)] * (1 - linkDensity(c))
+		scores[c.Get(0)] = score
+		if top == nil || score > topScore {
+			top, topScore = c, score
+		}
+	}
+
+	// 合并得分接近的兄弟节点
+	threshold := math.Max(10, topScore*0.2)
+	content, _ := goquery.NewDocumentFromReader(strings.NewReader(`<div></div>`))
+	container := content.Find(`div`)
+	parent := top.Parent()
+	if parent.Length() == 0 || goquery.NodeName(parent) == `html` {
+		container.AppendSelection(top.Clone())
+		return container
+	}
+	parent.Children().Each(func(_ int, s *goquery.Selection) {
+		appendable := s.IsSelection(top)
+		if !appendable {
+			if score, ok := scores[s.Get(0)]; ok && score >= threshold {
+				appendable = true
+			} else if goquery.NodeName(s) == `p` {
+				text := normalizeSpace(s.Text())
+				density := linkDensity(s)
+				length := len([]rune(text))
+				appendable = (length > 80 && density < 0.25) || (length > 0 && length <= 80 && density == 0 && strings.ContainsAny(text, `.。`))
+			}
+		}
+		if appendable {
+			container.AppendSelection(s.Clone())
+		}
+	})
+	readabilityClean(container)
+	return container
+}
+
+// readabilityClean 删除正文中链接密度过高或内容过少的列表、表格和div
+func readabilityClean(s *goquery.Selection) {
+	s.Find(`ul,ol,table,div,section`).Each(func(_ int, c *goquery.Selection) {
+		weight := classWeight(c)
+		if weight < 0 {
+			c.Remove()
+			return
+		}
+		text := normalizeSpace(c.Text())
+		if strings.Count(text, `,`)+strings.Count(text, `，`) >= 10 {
+			return
+		}
+		density := linkDensity(c)
+		imgs := c.Find(`img`).Length()
+		ps := c.Find(`p`).Length()
+		length := len([]rune(text))
+		if (density > 0.5 && weight < 25) || (imgs > 1 && ps > 0 && float64(ps)/float64(imgs) < 0.5) || (imgs == 0 && length < 25 && c.Find(`pre,code,blockquote`).Length() == 0 && goquery.NodeName(c) != `table`) {
+			c.Remove()
+		}
+	})
+}
+
+// readabilityTextBlocks 纯文本中各自成段的元素
+var readabilityTextBlocks = map[string]bool{
+	`p`: true, `pre`: true, `li`: true, `blockquote`: true, `td`: true,
+	`h1`: true, `h2`: true, `h3`: true, `h4`: true, `h5`: true, `h6`: true,
+}
+
+// readabilityContainers 其中不在段落中的文本各自成段的元素
+var readabilityContainers = map[string]bool{
+	`div`: true, `section`: true, `article`: true, `main`: true, `header`: true, `figure`: true,
+	`ul`: true, `ol`: true, `dl`: true, `table`: true, `tr`: true, `br`: true, `hr`: true,
+}
+
+// readabilityText 将正文转为纯文本，块级元素之间换行(不在段落中的文本也会保留)
+func readabilityText(s *goquery.Selection) string {
+	var (
+		lines  []string
+		inline strings.Builder
+	)
+	flush := func() {
+		if text := normalizeSpace(inline.String()); len(text) > 0 {
+			lines = append(lines, text)
+		}
+		inline.Reset()
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				inline.WriteString(c.Data)
+			case c.Type != html.ElementNode:
+			case readabilityTextBlocks[c.Data]:
+				flush()
+				if text := normalizeSpace(goquery.NewDocumentFromNode(c).Text()); len(text) > 0 {
+					lines = append(lines, text)
+				}
+			case readabilityContainers[c.Data]:
+				flush()
+				walk(c)
+				flush()
+			default:
+				walk(c)
+			}
+		}
+	}
+	for _, n := range s.Nodes {
+		walk(n)
+	}
+	flush()
+	return strings.Join(lines, "\n\n")
+}
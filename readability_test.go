@@ -0,0 +1,46 @@
+package gopiper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadability(t *testing.T) {
+	body := []byte(`<html><head><title>Big News - Example Site</title>
+<meta property="og:image" content="http://example.com/lead.jpg">
+<meta name="author" content="Jane Doe"></head>
+<body>
+<div id="header"><a href="/">Home</a> <a href="/news">News</a></div>
+<div class="sidebar"><ul><li><a href="/1">Link one</a></li><li><a href="/2">Link two</a></li></ul></div>
+<div class="article-content">
+	<h1>Big News</h1>
+	<p>The first paragraph of the story, with enough words, commas, and detail to be scored as content.</p>
+	<p>The second paragraph continues the story, adding more context, quotes, and background for readers.</p>
+	<div class="share"><a href="/share">Share</a></div>
+</div>
+<div id="footer">Copyright</div>
+<script>var x = 1;</script>
+</body></html>`)
+	pipe := PipeItem{Type: "readability"}
+	v, err := pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	m := v.(map[string]interface{})
+	assert.Equal(t, "Big News", m["title"])
+	assert.Equal(t, "Jane Doe", m["byline"])
+	assert.Equal(t, "http://example.com/lead.jpg", m["image"])
+	assert.Equal(t, "The first paragraph of the story, with enough words, commas, and detail to be scored as content.\n\n"+
+		"The second paragraph continues the story, adding more context, quotes, and background for readers.", m["text"])
+	assert.NotContains(t, m["content"], "Share")
+	assert.NotContains(t, m["content"], "Link one")
+
+	pipe = PipeItem{Type: "readability[text]", Selector: "body"}
+	v, err = pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, m["text"], v)
+
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(`<div>Loose text before <b>bold</b><p>A paragraph.</p>Loose text after<br>next line<ul><li>Item</li></ul></div>`))
+	assert.Equal(t, "Loose text before bold\n\nA paragraph.\n\nLoose text after\n\nnext line\n\nItem", readabilityText(doc.Find(`div`)))
+}
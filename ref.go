@@ -0,0 +1,217 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// refExp 引用其它字段的值。{$.id} 引用同一map中已提取的字段，{$.parent.id} 引用上一级map中的字段(可以重复，例如 {$.parent.parent.id})，
+// 字段名之后可以带路径，例如 {$.info.name}、{$.images[0]}
+var refExp = regexp.MustCompile(`\{\$\.((?:parent\.)*)([^{}]+)\}`)
+
+// valueScope 可引用的字段：同一map中已提取的字段及各上级map中的字段
+type valueScope struct {
+	values map[string]interface{}
+	parent *valueScope
+}
+
+// child 创建下一级map的作用域
+func (s *valueScope) child(values map[string]interface{}) *valueScope {
+	return &valueScope{values: values, parent: s}
+}
+
+// up 返回上 n 级的作用域
+func (s *valueScope) up(n int) *valueScope {
+	for ; n > 0 && s != nil; n-- {
+		s = s.parent
+	}
+	return s
+}
+
+func (s *valueScope) get(path string) (interface{}, bool) {
+	if s == nil {
+		return nil, false
+	}
+	return GetPath(s.values, path)
+}
+
+// lookup 查找引用的值。ups 为路径前面的“parent.”，当前map中有名为 parent 的字段时优先在该字段中查找
+func (s *valueScope) lookup(ups string, path string) (interface{}, bool) {
+	if len(ups) > 0 && s != nil {
+		if _, ok := s.values[`parent`]; ok {
+			if v, ok := s.get(ups + path); ok && v != nil {
+				return v, true
+			}
+		}
+	}
+	return s.up(strings.Count(ups, `.`)).get(path)
+}
+
+func refString(v interface{}) string {
+	switch v.(type) {
+	case nil, string, bool, float64, float32, int, int64, int32, uint, uint64, uint32, json.Number:
+		return exprString(v)
+	}
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// exprLiteral 将引用的值转为 expr 表达式中的字面量
+func exprLiteral(v interface{}) string {
+	switch v.(type) {
+	case bool, float64, float32, int, int64, int32, uint, uint64, uint32, json.Number:
+		return refString(v)
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(refString(v)) + `"`
+}
+
+// jsLiteral 将引用的值转为 JavaScript 字面量
+func jsLiteral(v interface{}) string {
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return exprLiteral(v)
+}
+
+// replaceRefs 将 value 中的 {$.field} 替换为引用的值
+func (s *valueScope) replaceRefs(value string) (string, error) {
+	return s.replaceRefsWith(value, refString)
+}
+
+// replaceRefsWith 将 value 中的 {$.field} 替换为 encode 转换后的引用值
+func (s *valueScope) replaceRefsWith(value string, encode func(interface{}) string) (string, error) {
+	var err error
+	value = refExp.ReplaceAllStringFunc(value, func(ref string) string {
+		m := refExp.FindStringSubmatch(ref)
+		v, ok := s.lookup(m[1], m[2])
+		if !ok || v == nil {
+			if err == nil {
+				err = fmt.Errorf("%w: %s", ErrRefNotFound, ref)
+			}
+			return ``
+		}
+		return encode(v)
+	})
+	return value, err
+}
+
+// resolveRefs 替换选择器中引用的值，并检查过滤器中引用的字段是否存在。没有引用时返回 p 本身，否则返回替换后的副本。
+// 过滤器中的引用在解析过滤器链之后才替换(见 resolveParams)，引用的值不会被当作过滤器执行
+func (p *PipeItem) resolveRefs() (*PipeItem, error) {
+	if p.Type == PT_EXPR || !strings.Contains(p.Selector+p.Filter, `{$.`) {
+		return p, nil
+	}
+	resolved := *p
+	var err error
+	if resolved.Selector, err = p.scope.replaceRefs(p.Selector); err != nil {
+		return p, err
+	}
+	if _, err = p.scope.replaceRefs(p.Filter); err != nil {
+		return p, err
+	}
+	if p.node != nil {
+		p.node.Selector = resolved.Selector
+	}
+	return &resolved, nil
+}
+
+// resolveParams 替换过滤器参数中引用的值。参数为过滤器链的过滤器(each 等)不替换，由其中的过滤器各自替换；
+// expr 和 js 的参数中替换为字面量
+func (p *PipeItem) resolveParams(name string, params string) string {
+	if p.scope == nil || !strings.Contains(params, `{$.`) {
+		return params
+	}
+	encode := refString
+	switch name {
+	case `expr`:
+		encode = exprLiteral
+	case `js`:
+		encode = jsLiteral
+	default:
+		if chainFilters[name] {
+			return params
+		}
+	}
+	res, _ := p.scope.replaceRefsWith(params, encode)
+	return res
+}
+
+// resolveValue 替换条件、分支值等非过滤器链的参数中引用的值
+func (p *PipeItem) resolveValue(value string) string {
+	return p.resolveParams(``, value)
+}
+
+// dependencies 返回规则项引用的同级字段名
+func (p *PipeItem) dependencies() []string {
+	var names []string
+	for _, m := range refExp.FindAllStringSubmatch(p.Selector+p.Filter, -1) {
+		if len(m[1]) == 0 {
+			names = append(names, splitPath(m[2])[0])
+		} else {
+			names = append(names, `parent`) // 同级的 parent 字段
+		}
+	}
+	if p.Type == PT_EXPR {
+		names = append(names, exprIdentifiers(p.Selector)...)
+	}
+	return names
+}
+
+// orderSubItems 按依赖关系排列map的子规则：被引用的字段先执行，没有依赖关系的保持原来的顺序。存在循环引用时返回错误
+func orderSubItems(items []PipeItem) ([]PipeItem, error) {
+	index := make(map[string]int, len(items))
+	for i, item := range items {
+		if len(item.Name) > 0 && !namePlaceholder.MatchString(item.Name) {
+			index[item.Name] = i
+		}
+	}
+	deps := make([][]int, len(items))
+	hasDeps := false
+	for i, item := range items {
+		for _, name := range item.dependencies() {
+			if j, ok := index[name]; ok && j != i {
+				deps[i] = append(deps[i], j)
+				hasDeps = true
+			}
+		}
+	}
+	if !hasDeps {
+		return items, nil
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(items))
+	res := make([]PipeItem, 0, len(items))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrCircularRef, items[i].Name)
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		res = append(res, items[i])
+		return nil
+	}
+	for i := range items {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,116 @@
+package gopiper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueRefs(t *testing.T) {
+	body := []byte(`<div class="shop" data-id="s1">
+<h1>ACME</h1>
+<ul><li data-id="1"><span>Phone</span></li><li data-id="2"><span>Pad</span></li></ul>
+<p class="desc-1">first</p><p class="desc-2">second</p>
+</div>`)
+	item := PipeItem{
+		Type:     PT_MAP,
+		Selector: `.shop`,
+		SubItem: []PipeItem{
+			{Name: `url`, Type: PT_RAW, Selector: `https://example.com/shop/{$.id}`},
+			{Name: `desc`, Type: PT_TEXT, Selector: `.desc-{$.id}`},
+			{Name: `label`, Type: PT_EXPR, Selector: `name + "#" + id`},
+			{Name: `id`, Type: PT_TEXT, Selector: `h1`, Filter: `replace(ACME,1)`},
+			{Name: `name`, Type: PT_TEXT, Selector: `h1`},
+			{Name: `items`, Type: PT_ARRAY, Selector: `li`, SubItem: []PipeItem{
+				{Type: PT_MAP, SubItem: []PipeItem{
+					{Name: `id`, Type: `attr[data-id]`},
+					{Name: `title`, Type: PT_TEXT, Selector: `span`, Filter: `preadd({$.parent.name} )`},
+					{Name: `url`, Type: PT_EXPR, Selector: `parent.url + "/" + id`},
+				}},
+			}},
+		},
+	}
+	r, e := item.PipeBytes(body, `html`)
+	assert.NoError(t, e)
+	assert.Equal(t, map[string]interface{}{
+		`url`:   `https://example.com/shop/1`,
+		`desc`:  `first`,
+		`label`: `ACME#1`,
+		`id`:    `1`,
+		`name`:  `ACME`,
+		`items`: []interface{}{
+			map[string]interface{}{`id`: `1`, `title`: `ACME Phone`, `url`: `https://example.com/shop/1/1`},
+			map[string]interface{}{`id`: `2`, `title`: `ACME Pad`, `url`: `https://example.com/shop/1/2`},
+		},
+	}, r)
+
+	_, e = orderSubItems([]PipeItem{
+		{Name: `a`, Type: PT_RAW, Selector: `{$.b}`},
+		{Name: `b`, Type: PT_EXPR, Selector: `a + 1`},
+	})
+	assert.True(t, errors.Is(e, ErrCircularRef))
+
+	scope := (&valueScope{values: map[string]interface{}{`tags`: []interface{}{`a`, `b`}}}).child(map[string]interface{}{`id`: 1})
+	s, e := scope.replaceRefs(`{$.id}-{$.parent.tags}-{$.parent.tags[1]}`)
+	assert.NoError(t, e)
+	assert.Equal(t, `1-["a","b"]-b`, s)
+	_, e = scope.replaceRefs(`{$.missing}`)
+	assert.True(t, errors.Is(e, ErrRefNotFound))
+}
+
+func TestValueRefsInjection(t *testing.T) {
+	body := []byte(`<div><h1>x)|sprintf(http://169.254.169.254/%s)|fetch(text</h1><h2>a"+b</h2></div>`)
+	var fetched []string
+	item := PipeItem{
+		Type:     PT_MAP,
+		Selector: `div`,
+		SubItem: []PipeItem{
+			{Name: `name`, Type: PT_TEXT, Selector: `h1`},
+			{Name: `title`, Type: PT_TEXT, Selector: `h2`},
+			{Name: `url`, Type: PT_RAW, Selector: `hello`, Filter: `preadd({$.name})`},
+			{Name: `each`, Type: PT_RAW, Selector: `hello`, Filter: `each(preadd({$.name}))`},
+			{Name: `cond`, Type: PT_RAW, Selector: `x)|fetch(text`, Filter: `if(. == {$.name},=matched,=no)`},
+			{Name: `expr`, Type: PT_RAW, Selector: `1`, Filter: `expr({$.title} + value)`},
+			{Name: `js`, Type: PT_RAW, Selector: `1`, Filter: `js({$.title} + value)`},
+			{Name: `ref`, Type: PT_RAW, Selector: `{$.title}!`},
+		},
+	}
+	item.SetFetcher(func(url string) ([]byte, error) {
+		fetched = append(fetched, url)
+		return nil, nil
+	})
+	trace := NewTrace()
+	item.SetTrace(trace)
+	r, e := item.PipeBytes(body, `html`)
+	assert.NoError(t, e)
+	assert.Empty(t, fetched)
+	name := `x)|sprintf(http://169.254.169.254/%s)|fetch(text`
+	assert.Equal(t, map[string]interface{}{
+		`name`:  name,
+		`title`: `a"+b`,
+		`url`:   name + `hello`,
+		`each`:  name + `hello`,
+		`cond`:  `no`,
+		`expr`:  `a"+b1`,
+		`js`:    `a"+b1`,
+		`ref`:   `a"+b!`,
+	}, r)
+	url := trace.Children[0].Children[2]
+	assert.Equal(t, `url`, url.Name)
+	assert.Equal(t, `preadd`, url.Filters[0].Name)
+	assert.Equal(t, name, url.Filters[0].Params)
+	assert.Equal(t, `a"+b!`, trace.Children[0].Children[7].Selector)
+
+	// 同级的 parent 字段优先
+	item = PipeItem{
+		Type: PT_MAP,
+		SubItem: []PipeItem{
+			{Name: `title`, Type: PT_RAW, Selector: `{$.parent.name}`},
+			{Name: `parent`, Type: PT_MAP, SubItem: []PipeItem{{Name: `name`, Type: PT_RAW, Selector: `p`}}},
+		},
+	}
+	r, e = item.PipeBytes([]byte(`<p></p>`), `html`)
+	assert.NoError(t, e)
+	assert.Equal(t, `p`, r.(map[string]interface{})[`title`])
+}
@@ -0,0 +1,209 @@
+package gopiper
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/admpub/regexp2"
+)
+
+// DefaultRegexpTimeout regexp2 正则匹配的默认超时时间(0代表不限制)
+var DefaultRegexpTimeout time.Duration
+
+// MaxRegexp2Cache 缓存的已编译 regexp2 正则表达式数量上限
+var MaxRegexp2Cache = 1000
+
+type regexp2CacheKey struct {
+	expr    string
+	opt     regexp2.RegexOptions
+	timeout time.Duration
+}
+
+var regexp2Cache = newLRUCache()
+
+// compileRegexp2 编译 regexp2 正则表达式(带缓存)。timeout 小于等于0时不限制匹配时间
+func compileRegexp2(expr string, opt regexp2.RegexOptions, timeout time.Duration) (*regexp2.Regexp, error) {
+	if timeout < 0 {
+		timeout = 0
+	}
+	key := regexp2CacheKey{expr: expr, opt: opt, timeout: timeout}
+	if re, ok := regexp2Cache.get(key); ok {
+		return re.(*regexp2.Regexp), nil
+	}
+	re, err := regexp2.Compile(expr, opt)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		re.MatchTimeout = timeout
+	}
+	regexp2Cache.add(key, re, MaxRegexp2Cache)
+	return re, nil
+}
+
+// SetRegexpTimeout 设置本次执行中 regexp2 正则匹配的超时时间
+func (p *PipeItem) SetRegexpTimeout(timeout time.Duration) {
+	p.regexpTimeout = timeout
+}
+
+func (p *PipeItem) RegexpTimeout() time.Duration {
+	if p.regexpTimeout > 0 {
+		return p.regexpTimeout
+	}
+	return DefaultRegexpTimeout
+}
+
+// compileRegexp2 按本次执行的超时设置编译 regexp2 正则表达式
+func (p *PipeItem) compileRegexp2(expr string) (*regexp2.Regexp, error) {
+	return compileRegexp2(expr, regexp2.RE2, p.RegexpTimeout())
+}
+
+// regexp2Error 将 regexp2 的匹配超时错误转换为 *RegexpTimeoutError
+func regexp2Error(re *regexp2.Regexp, err error) error {
+	if err == nil || !strings.HasPrefix(err.Error(), `match timeout after `) {
+		return err
+	}
+	return &RegexpTimeoutError{Pattern: re.String(), Timeout: re.MatchTimeout}
+}
+
+// regexpSelector 解析正则选择器前缀
+// regexp: / regexp2: 仅使用第一个匹配结果；regexpall: / regexp2all: 使用所有匹配结果
+func regexpSelector(selector string) (expr string, useRegexp2 bool, all bool, ok bool) {
+	switch {
+	case strings.HasPrefix(selector, REGEXP_PRE):
+		return selector[len(REGEXP_PRE):], false, false, true
+	case strings.HasPrefix(selector, REGEXP2_PRE):
+		return selector[len(REGEXP2_PRE):], true, false, true
+	case strings.HasPrefix(selector, REGEXP_ALL_PRE):
+		return selector[len(REGEXP_ALL_PRE):], false, true, true
+	case strings.HasPrefix(selector, REGEXP2_ALL_PRE):
+		return selector[len(REGEXP2_ALL_PRE):], true, true, true
+	}
+	return selector, false, false, false
+}
+
+// regexpMatch 一次正则匹配的结果
+type regexpMatch struct {
+	text   string            // 完整匹配的文本
+	groups []string          // 捕获组(不含完整匹配)
+	named  map[string]string // 命名捕获组，例如 (?P<price>\d+)
+}
+
+// value 有捕获组时返回第一个捕获组，否则返回完整匹配的文本
+func (m *regexpMatch) value() string {
+	if len(m.groups) > 0 {
+		return m.groups[0]
+	}
+	return m.text
+}
+
+func (m *regexpMatch) namedMap() map[string]interface{} {
+	res := make(map[string]interface{}, len(m.named))
+	for k, v := range m.named {
+		res[k] = v
+	}
+	return res
+}
+
+func newRegexpMatch(sv []string, names []string) *regexpMatch {
+	m := &regexpMatch{text: sv[0], groups: sv[1:]}
+	for i, name := range names {
+		if i == 0 || len(name) == 0 || i >= len(sv) {
+			continue
+		}
+		if m.named == nil {
+			m.named = map[string]string{}
+		}
+		m.named[name] = sv[i]
+	}
+	return m
+}
+
+func newRegexp2Match(mch *regexp2.Match) *regexpMatch {
+	groups := mch.Groups()
+	m := &regexpMatch{text: groups[0].String()}
+	for _, g := range groups[1:] {
+		m.groups = append(m.groups, g.String())
+		if isNumericName(g.Name) {
+			continue
+		}
+		if m.named == nil {
+			m.named = map[string]string{}
+		}
+		m.named[g.Name] = g.String()
+	}
+	return m
+}
+
+func isNumericName(name string) bool {
+	for _, r := range name {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return len(name) > 0
+}
+
+// findAllRegexp 查找所有匹配结果
+func findAllRegexp(exp *regexp.Regexp, body string) []*regexpMatch {
+	var matches []*regexpMatch
+	names := exp.SubexpNames()
+	for _, sv := range exp.FindAllStringSubmatch(body, -1) {
+		matches = append(matches, newRegexpMatch(sv, names))
+	}
+	return matches
+}
+
+// findAllRegexp2 查找所有匹配结果
+func findAllRegexp2(exp *regexp2.Regexp, body string) ([]*regexpMatch, error) {
+	var matches []*regexpMatch
+	mch, err := exp.FindStringMatch(body)
+	for mch != nil && err == nil {
+		matches = append(matches, newRegexp2Match(mch))
+		mch, err = exp.FindNextMatch(mch)
+	}
+	return matches, regexp2Error(exp, err)
+}
+
+// pipeRegexpMatch 对单个匹配结果执行规则。map 类型会将命名捕获组作为结果的初始值
+func (p *PipeItem) pipeRegexpMatch(m *regexpMatch) (res interface{}, err error) {
+	if p.Type != PT_MAP || len(m.named) == 0 {
+		return p.pipeText([]byte(m.value()))
+	}
+	defer p.endItem(&res, &err)
+	if err = p.beginItem(); err != nil {
+		return nil, err
+	}
+	return p.pipeRegexpMap(m, m.value())
+}
+
+func (p *PipeItem) pipeRegexpMap(m *regexpMatch, rs string) (interface{}, error) {
+	var res map[string]interface{}
+	if m != nil {
+		res = m.namedMap()
+	} else {
+		res = make(map[string]interface{})
+	}
+	if len(p.SubItem) == 0 && len(res) == 0 {
+		return nil, ErrArrayNeedSubItem
+	}
+	subitems, err := orderSubItems(p.SubItem)
+	if err != nil {
+		return nil, err
+	}
+	for _, subitem := range subitems {
+		if len(subitem.Name) == 0 {
+			continue
+		}
+		subitem.CopyFrom(p)
+		subitem.Name = replaceName(subitem.Name, res)
+		subitem.scope = p.scope.child(res)
+		var err error
+		res[subitem.Name], err = subitem.pipeText([]byte(rs))
+		if isAbort(err) {
+			return nil, err
+		}
+	}
+	return callFilter(p, res, p.Filter)
+}
@@ -0,0 +1,219 @@
+package gopiper
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// 延迟加载图片时常用的属性(优先级从高到低)
+var LazyLoadAttrs = []string{`data-src`, `data-original`, `data-lazy-src`, `data-url`, `data-echo`}
+
+// 延迟加载图片时常用的 srcset 属性
+var LazyLoadSrcsetAttrs = []string{`data-srcset`, `data-lazy-srcset`}
+
+// 各标签中值为资源网址的属性
+var resourceAttrs = map[string][]string{
+	`img`:    {`src`, `srcset`},
+	`source`: {`src`, `srcset`},
+	`video`:  {`src`, `poster`},
+	`audio`:  {`src`},
+	`track`:  {`src`},
+	`a`:      {`href`},
+}
+
+// ResourceRewriter 改写HTML片段中的资源网址
+type ResourceRewriter struct {
+	Base  *neturl.URL                          // 用于将相对网址转为绝对网址，为nil时不转换
+	Store func(fileURL string) (string, error) // 用于保存资源文件(不用于a标签)，为nil时不保存
+	// Errors 保存失败的资源文件(这些网址保留为绝对网址)
+	Errors []error
+	saved  map[string]string
+}
+
+func (r *ResourceRewriter) resolve(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) == 0 || strings.HasPrefix(v, `#`) {
+		return v
+	}
+	lower := strings.ToLower(v)
+	for _, prefix := range []string{`data:`, `javascript:`, `mailto:`, `tel:`, `about:`} {
+		if strings.HasPrefix(lower, prefix) {
+			return v
+		}
+	}
+	if r.Base == nil {
+		return v
+	}
+	u, err := neturl.Parse(v)
+	if err != nil {
+		return v
+	}
+	return r.Base.ResolveReference(u).String()
+}
+
+func (r *ResourceRewriter) store(v string) string {
+	v = r.resolve(v)
+	if r.Store == nil || !(strings.HasPrefix(v, `http://`) || strings.HasPrefix(v, `https://`)) {
+		return v
+	}
+	if saved, ok := r.saved[v]; ok {
+		return saved
+	}
+	newPath, err := r.Store(v)
+	if err != nil {
+		r.Errors = append(r.Errors, fmt.Errorf("Store %s: %w", v, err))
+		return v // 保存失败时保留绝对网址
+	}
+	if len(newPath) == 0 {
+		return v
+	}
+	if r.saved == nil {
+		r.saved = map[string]string{}
+	}
+	r.saved[v] = newPath
+	return newPath
+}
+
+// srcsetCandidate srcset 中的一项
+type srcsetCandidate struct {
+	url        string
+	descriptor string // 例如 1x、300w
+}
+
+// parseSrcset 按 HTML 标准解析 srcset：网址为连续的非空白字符(末尾的逗号是分隔符)，其后到逗号(不含括号中的逗号)为描述符。
+// 网址中可以包含逗号，例如 data: 网址
+func parseSrcset(v string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+	}
+	for i := 0; i < len(v); {
+		for i < len(v) && (isSpace(v[i]) || v[i] == ',') {
+			i++
+		}
+		if i >= len(v) {
+			break
+		}
+		start := i
+		for i < len(v) && !isSpace(v[i]) {
+			i++
+		}
+		c := srcsetCandidate{url: v[start:i]}
+		if trimmed := strings.TrimRight(c.url, `,`); len(trimmed) < len(c.url) {
+			c.url = trimmed
+			candidates = append(candidates, c)
+			continue
+		}
+		start = i
+		depth := 0
+		for ; i < len(v); i++ {
+			if v[i] == '(' {
+				depth++
+			} else if v[i] == ')' && depth > 0 {
+				depth--
+			} else if v[i] == ',' && depth == 0 {
+				break
+			}
+		}
+		c.descriptor = strings.TrimSpace(v[start:i])
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// rewriteSrcset 改写 srcset 中的每个网址，例如 "a.jpg 1x, b.jpg 2x"
+func (r *ResourceRewriter) rewriteSrcset(v string) string {
+	candidates := parseSrcset(v)
+	items := make([]string, len(candidates))
+	for i, c := range candidates {
+		items[i] = r.store(c.url)
+		if len(c.descriptor) > 0 {
+			items[i] += ` ` + c.descriptor
+		}
+	}
+	return strings.Join(items, `, `)
+}
+
+// Rewrite 改写HTML片段中 img/source/video/audio 的资源网址(包括延迟加载属性)以及 a 标签的 href
+func (r *ResourceRewriter) Rewrite(src string) (string, error) {
+	body, err := parseHTMLFragment(src)
+	if err != nil {
+		return ``, err
+	}
+	r.rewriteNode(body)
+	b := &strings.Builder{}
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(b, c); err != nil {
+			return ``, err
+		}
+	}
+	return b.String(), nil
+}
+
+func (r *ResourceRewriter) rewriteNode(n *html.Node) {
+	if n.Type == html.ElementNode {
+		tag := strings.ToLower(n.Data)
+		if tag == `img` || tag == `source` {
+			promoteLazyAttr(n, `src`, LazyLoadAttrs)
+			promoteLazyAttr(n, `srcset`, LazyLoadSrcsetAttrs)
+		}
+		for _, key := range resourceAttrs[tag] {
+			for i, a := range n.Attr {
+				if a.Key != key {
+					continue
+				}
+				switch {
+				case key == `srcset`:
+					n.Attr[i].Val = r.rewriteSrcset(a.Val)
+				case tag == `a`:
+					n.Attr[i].Val = r.resolve(a.Val)
+				default:
+					n.Attr[i].Val = r.store(a.Val)
+				}
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.rewriteNode(c)
+	}
+}
+
+// promoteLazyAttr 用延迟加载属性的值替换 attr 属性(删除延迟加载属性)
+func promoteLazyAttr(n *html.Node, attr string, lazyAttrs []string) {
+	var value string
+	for _, lazy := range lazyAttrs {
+		if v := strings.TrimSpace(nodeAttr(n, lazy)); len(v) > 0 {
+			value = v
+			break
+		}
+	}
+	if len(value) == 0 {
+		return
+	}
+	attrs := n.Attr[:0]
+	found := false
+	for _, a := range n.Attr {
+		isLazy := false
+		for _, lazy := range lazyAttrs {
+			if a.Key == lazy {
+				isLazy = true
+				break
+			}
+		}
+		if isLazy {
+			continue
+		}
+		if a.Key == attr {
+			a.Val = value
+			found = true
+		}
+		attrs = append(attrs, a)
+	}
+	if !found {
+		attrs = append(attrs, html.Attribute{Key: attr, Val: value})
+	}
+	n.Attr = attrs
+}
@@ -0,0 +1,202 @@
+package gopiper
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+func init() {
+	RegisterSanitizePolicy(`strict`, NewSanitizePolicy())
+	RegisterSanitizePolicy(`basic`, NewSanitizePolicy().
+		AllowElements(`p`, `br`, `b`, `strong`, `i`, `em`, `u`, `s`, `del`, `ins`, `sub`, `sup`, `small`, `mark`, `span`, `code`, `pre`, `blockquote`, `hr`))
+	RegisterSanitizePolicy(`ugc`, NewSanitizePolicy().
+		AllowElements(`p`, `br`, `b`, `strong`, `i`, `em`, `u`, `s`, `del`, `ins`, `sub`, `sup`, `small`, `mark`, `span`, `code`, `pre`, `blockquote`, `hr`,
+			`h1`, `h2`, `h3`, `h4`, `h5`, `h6`, `ul`, `ol`, `li`, `dl`, `dt`, `dd`, `div`, `section`, `article`, `figure`, `figcaption`,
+			`table`, `thead`, `tbody`, `tfoot`, `tr`, `th`, `td`, `caption`, `a`, `img`, `abbr`, `cite`, `q`, `time`).
+		AllowAttrs([]string{`href`, `title`}, `a`).
+		AllowAttrs([]string{`src`, `alt`, `title`, `width`, `height`}, `img`).
+		AllowAttrs([]string{`colspan`, `rowspan`}, `th`, `td`).
+		AllowAttrs([]string{`cite`}, `blockquote`, `q`).
+		AllowAttrs([]string{`datetime`}, `time`).
+		AllowAttrs([]string{`start`}, `ol`).
+		RequireNofollow(true))
+}
+
+// SanitizePolicy HTML白名单策略
+type SanitizePolicy struct {
+	Elements   map[string]map[string]bool // 允许的标签 => 允许的属性
+	Global     map[string]bool            // 所有允许的标签都可以使用的属性
+	URLSchemes map[string]bool            // 链接类属性允许的协议(相对网址总是允许的)
+	Nofollow   bool                       // 为链接添加 rel="nofollow"
+}
+
+// NewSanitizePolicy 创建不允许任何标签的策略(只保留文本)
+func NewSanitizePolicy() *SanitizePolicy {
+	return &SanitizePolicy{
+		Elements:   map[string]map[string]bool{},
+		Global:     map[string]bool{},
+		URLSchemes: map[string]bool{`http`: true, `https`: true, `mailto`: true},
+	}
+}
+
+// AllowElements 允许指定的标签(不含属性)
+func (s *SanitizePolicy) AllowElements(tags ...string) *SanitizePolicy {
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		if _, ok := s.Elements[tag]; !ok {
+			s.Elements[tag] = map[string]bool{}
+		}
+	}
+	return s
+}
+
+// AllowAttrs 允许指定标签的属性。不指定标签时，所有允许的标签都可以使用这些属性
+func (s *SanitizePolicy) AllowAttrs(attrs []string, tags ...string) *SanitizePolicy {
+	if len(tags) == 0 {
+		for _, attr := range attrs {
+			s.Global[strings.ToLower(attr)] = true
+		}
+		return s
+	}
+	s.AllowElements(tags...)
+	for _, tag := range tags {
+		for _, attr := range attrs {
+			s.Elements[strings.ToLower(tag)][strings.ToLower(attr)] = true
+		}
+	}
+	return s
+}
+
+// AllowURLSchemes 设置链接类属性允许的协议
+func (s *SanitizePolicy) AllowURLSchemes(schemes ...string) *SanitizePolicy {
+	s.URLSchemes = map[string]bool{}
+	for _, scheme := range schemes {
+		s.URLSchemes[strings.ToLower(scheme)] = true
+	}
+	return s
+}
+
+func (s *SanitizePolicy) RequireNofollow(on bool) *SanitizePolicy {
+	s.Nofollow = on
+	return s
+}
+
+var sanitizePolicies = map[string]*SanitizePolicy{}
+
+// RegisterSanitizePolicy 注册可在 sanitize(policy) 过滤器中使用的策略
+func RegisterSanitizePolicy(name string, policy *SanitizePolicy) {
+	if _, existing := sanitizePolicies[name]; existing {
+		panic(fmt.Sprintf("Sanitize policy with name '%s' is already registered.", name))
+	}
+	sanitizePolicies[name] = policy
+}
+
+func GetSanitizePolicy(name string) (*SanitizePolicy, bool) {
+	policy, ok := sanitizePolicies[name]
+	return policy, ok
+}
+
+// 内容会被整个删除的标签
+var sanitizeDropContent = map[string]bool{
+	`script`: true, `style`: true, `noscript`: true, `template`: true, `iframe`: true, `frame`: true, `frameset`: true,
+	`object`: true, `embed`: true, `applet`: true, `svg`: true, `math`: true, `head`: true, `title`: true,
+	`textarea`: true, `select`: true, `button`: true,
+}
+
+// 值为网址的属性
+var urlAttrs = map[string]bool{
+	`href`: true, `src`: true, `cite`: true, `action`: true, `formaction`: true, `poster`: true, `background`: true, `longdesc`: true, `data`: true,
+}
+
+// Sanitize 按策略过滤HTML：不允许的标签会被去掉(保留其中的文本)，不允许的属性、事件属性以及不安全的网址会被删除
+func (s *SanitizePolicy) Sanitize(src string) (string, error) {
+	body, err := parseHTMLFragment(src)
+	if err != nil {
+		return ``, err
+	}
+	s.sanitizeChildren(body)
+	b := &strings.Builder{}
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(b, c); err != nil {
+			return ``, err
+		}
+	}
+	return b.String(), nil
+}
+
+func (s *SanitizePolicy) sanitizeChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.ElementNode:
+			tag := strings.ToLower(c.Data)
+			s.sanitizeChildren(c)
+			if sanitizeDropContent[tag] {
+				n.RemoveChild(c)
+				break
+			}
+			attrs, ok := s.Elements[tag]
+			if !ok {
+				// 去掉标签，保留子节点
+				for gc := c.FirstChild; gc != nil; {
+					gnext := gc.NextSibling
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+					gc = gnext
+				}
+				n.RemoveChild(c)
+				break
+			}
+			s.sanitizeAttrs(c, tag, attrs)
+		case html.TextNode:
+		default:
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+func (s *SanitizePolicy) sanitizeAttrs(n *html.Node, tag string, allowed map[string]bool) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if len(a.Namespace) > 0 || strings.HasPrefix(key, `on`) || !(allowed[key] || s.Global[key]) {
+			continue
+		}
+		if urlAttrs[key] && !s.allowURL(a.Val) {
+			continue
+		}
+		if key == `style` && strings.Contains(strings.ToLower(a.Val), `expression`) {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+	if s.Nofollow && tag == `a` && len(nodeAttr(n, `href`)) > 0 {
+		for i, a := range n.Attr {
+			if a.Key == `rel` {
+				n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+				break
+			}
+		}
+		n.Attr = append(n.Attr, html.Attribute{Key: `rel`, Val: `nofollow`})
+	}
+}
+
+func (s *SanitizePolicy) allowURL(v string) bool {
+	v = strings.TrimSpace(v)
+	// 删除控制字符和空白后再检查协议，防止 "java\tscript:" 之类的绕过
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, v)
+	idx := strings.IndexAny(cleaned, `:/?#`)
+	if idx < 0 || cleaned[idx] != ':' {
+		return true // 相对网址
+	}
+	return s.URLSchemes[strings.ToLower(cleaned[:idx])]
+}
@@ -5,14 +5,21 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/admpub/gohttp"
-	"github.com/axgle/mahonia"
 	simplejson "github.com/bitly/go-simplejson"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestSplitParams(t *testing.T) {
+	assert.Equal(t, []string{`a`, ``, `b`}, SplitParams(`a,,b`))
+	assert.Equal(t, []string{`a`, ``}, SplitParams(`a,`))
+	assert.Equal(t, []string{`,b`, ``}, SplitParams(`\,b,`))
+}
+
 func TestRegexp(t *testing.T) {
 	/*
 		for i := 65281; i < 65375; i++ {
@@ -358,12 +365,10 @@ func TestHtmlJingJiang(t *testing.T) {
 	*/
 
 	defer resp.Body.Close()
-	bodyGBK, _ := io.ReadAll(resp.Body)
-
-	bodyUTF8 := mahonia.NewDecoder("gb18030").ConvertString(string(bodyGBK))
-	body := []byte(bodyUTF8)
+	body, _ := io.ReadAll(resp.Body)
 
 	pipe := PipeItem{}
+	pipe.SetCharset("gb18030")
 	err := json.Unmarshal([]byte(`
 		{
 			"type": "array",
@@ -517,3 +522,84 @@ func TestTTKBPaging(t *testing.T) {
 	fmt.Println(`=== [ TestTTKBPaging ] ===================================/`)
 	fmt.Println()
 }
+
+func TestRegexpAll(t *testing.T) {
+	body := `<li>apple: $1.50</li><li>pear: $2.25</li>`
+	pipe := PipeItem{
+		Type:     "float-array",
+		Selector: `regexpall:\$([\d.]+)`,
+	}
+	v, err := pipe.parseRegexp(body, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1.5, 2.25}, v)
+
+	for _, prefix := range []string{`regexpall:`, `regexp2all:`} {
+		pipe = PipeItem{Type: "string-array", Selector: prefix + `\$(?P<price>[\d.]+)`}
+		v, err = pipe.PipeBytes([]byte(body), "text")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1.50", "2.25"}, v, prefix)
+	}
+
+	for _, prefix := range []string{`regexpall:`, `regexp2all:`} {
+		pipe = PipeItem{
+			Type:     "array",
+			Selector: prefix + `<li>(?P<name>\w+): \$(?P<price>[\d.]+)</li>`,
+			SubItem: []PipeItem{
+				{Type: "map"},
+			},
+		}
+		v, err = pipe.PipeBytes([]byte(body), "text")
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"name": "apple", "price": "1.50"},
+			map[string]interface{}{"name": "pear", "price": "2.25"},
+		}, v)
+	}
+
+	pipe = PipeItem{
+		Type:     "map",
+		Selector: `regexp:(?P<name>\w+): \$(?P<price>[\d.]+)`,
+		SubItem: []PipeItem{
+			{Name: "label", Type: "string", Filter: "postadd(!)"},
+		},
+	}
+	v, err = pipe.PipeBytes([]byte(body), "text")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "apple", "price": "1.50", "label": "apple!"}, v)
+}
+
+func TestRegexpTimeout(t *testing.T) {
+	body := strings.Repeat(`a`, 5000) + `!`
+	pipe := PipeItem{
+		Type:     "string",
+		Selector: `regexp2:^(a+)+$`,
+	}
+	pipe.SetRegexpTimeout(50 * time.Millisecond)
+	_, err := pipe.PipeBytes([]byte(body), "text")
+	assert.True(t, IsRegexpTimeout(err))
+
+	pipe = PipeItem{Type: "string"}
+	pipe.SetRegexpTimeout(50 * time.Millisecond)
+	_, err = pipe.CallFilter(body, `regexpreplace(^(a+)+$,b)`)
+	assert.True(t, IsRegexpTimeout(err))
+
+	_, err = pipe.CallFilter([]string{`a`, body}, `regexpreplace(^(a+)+$,b)`)
+	assert.True(t, IsRegexpTimeout(err))
+	_, err = pipe.CallFilter(map[string]interface{}{`a`: []interface{}{body}}, `regexpreplace(^(a+)+$,b)`)
+	assert.True(t, IsRegexpTimeout(err))
+
+	re1, _ := compileRegexp2(`^a$`, 0, 0)
+	re2, _ := compileRegexp2(`^a$`, 0, 0)
+	assert.True(t, re1 == re2)
+
+	cache := newLRUCache()
+	for i := 0; i < 5; i++ {
+		cache.add(i, i, 3)
+		cache.get(0)
+	}
+	assert.Equal(t, 3, cache.len())
+	_, ok := cache.get(0) // 最近使用过，未被删除
+	assert.True(t, ok)
+	_, ok = cache.get(1)
+	assert.False(t, ok)
+}
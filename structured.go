@@ -0,0 +1,280 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// 例如：jsonld、jsonld[Product]、microdata[Article]、rdfa、opengraph[article]
+var structuredExp = regexp.MustCompile(`^(` + PT_JSONLD + `|` + PT_MICRODATA + `|` + PT_RDFA + `|` + PT_OPENGRAPH + `)(?:\[([^\]]+)\])?$`)
+
+// pipeStructured 提取页面中的结构化数据。有子规则时，第一个子规则按JSON选择器的语法从结果中提取数据
+func (p *PipeItem) pipeStructured(sel *goquery.Selection, kind string, typ string) (interface{}, error) {
+	var data interface{}
+	switch kind {
+	case PT_JSONLD:
+		data = filterStructuredType(parseJSONLD(sel), typ)
+	case PT_MICRODATA:
+		data = filterStructuredType(parseMicrodata(sel), typ)
+	case PT_RDFA:
+		data = filterStructuredType(parseRDFa(sel), typ)
+	case PT_OPENGRAPH:
+		og := parseOpenGraph(sel)
+		if len(typ) > 0 && og["type"] != typ {
+			og = map[string]interface{}{}
+		}
+		data = og
+	}
+	if len(p.SubItem) == 0 {
+		return callFilter(p, data, p.Filter)
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	parseItem := p.SubItem[0]
+	parseItem.CopyFrom(p)
+	res, err := parseItem.pipeJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	return callFilter(p, res, p.Filter)
+}
+
+// structuredTypeIs 判断 @type 是否匹配(忽略 http://schema.org/ 之类的前缀)
+func structuredTypeIs(v interface{}, typ string) bool {
+	switch t := v.(type) {
+	case string:
+		if t == typ {
+			return true
+		}
+		if idx := strings.LastIndexAny(t, "/#:"); idx >= 0 {
+			return t[idx+1:] == typ
+		}
+	case []interface{}:
+		for _, s := range t {
+			if structuredTypeIs(s, typ) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func filterStructuredType(items []interface{}, typ string) []interface{} {
+	if len(typ) == 0 {
+		return items
+	}
+	res := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if ok && structuredTypeIs(m["@type"], typ) {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// addStructuredValue 同名属性出现多次时转为数组
+func addStructuredValue(m map[string]interface{}, key string, value interface{}) {
+	old, ok := m[key]
+	if !ok {
+		m[key] = value
+		return
+	}
+	if arr, ok := old.([]interface{}); ok {
+		m[key] = append(arr, value)
+		return
+	}
+	m[key] = []interface{}{old, value}
+}
+
+// parseJSONLD 解析 <script type="application/ld+json">，@graph 中的条目会被展开
+func parseJSONLD(sel *goquery.Selection) []interface{} {
+	items := make([]interface{}, 0)
+	scripts := sel.Find(`script[type="application/ld+json"]`).AddSelection(sel.Filter(`script[type="application/ld+json"]`))
+	scripts.Each(func(_ int, s *goquery.Selection) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(s.Text())), &v); err != nil {
+			return
+		}
+		items = appendJSONLD(items, v)
+	})
+	return items
+}
+
+func appendJSONLD(items []interface{}, v interface{}) []interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		for _, item := range t {
+			items = appendJSONLD(items, item)
+		}
+	case map[string]interface{}:
+		graph, ok := t["@graph"].([]interface{})
+		if !ok {
+			return append(items, t)
+		}
+		for _, item := range graph {
+			if m, ok := item.(map[string]interface{}); ok {
+				if _, has := m["@context"]; !has && t["@context"] != nil {
+					m["@context"] = t["@context"]
+				}
+			}
+			items = appendJSONLD(items, item)
+		}
+	}
+	return items
+}
+
+// structuredPropValue 按HTML元素类型获取属性值
+func structuredPropValue(s *goquery.Selection, contentAttrs ...string) string {
+	for _, attr := range contentAttrs {
+		if v, ok := s.Attr(attr); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	var attr string
+	switch goquery.NodeName(s) {
+	case "meta":
+		attr = "content"
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		attr = "src"
+	case "a", "area", "link":
+		attr = "href"
+	case "object":
+		attr = "data"
+	case "data", "meter":
+		attr = "value"
+	case "time":
+		attr = "datetime"
+	}
+	if len(attr) > 0 {
+		if v, ok := s.Attr(attr); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
+
+// parseMicrodata 解析 schema.org 的 Microdata (itemscope/itemtype/itemprop)
+func parseMicrodata(sel *goquery.Selection) []interface{} {
+	items := make([]interface{}, 0)
+	sel.Find(`[itemscope]`).AddSelection(sel.Filter(`[itemscope]`)).Not(`[itemprop]`).Each(func(_ int, s *goquery.Selection) {
+		items = append(items, parseMicrodataItem(s))
+	})
+	return items
+}
+
+func parseMicrodataItem(scope *goquery.Selection) map[string]interface{} {
+	item := map[string]interface{}{}
+	if v := strings.Fields(scope.AttrOr("itemtype", "")); len(v) > 0 {
+		types := make([]interface{}, len(v))
+		for i, t := range v {
+			if idx := strings.LastIndexAny(t, "/#"); idx >= 0 {
+				t = t[idx+1:]
+			}
+			types[i] = t
+		}
+		if len(types) == 1 {
+			item["@type"] = types[0]
+		} else {
+			item["@type"] = types
+		}
+	}
+	if v, ok := scope.Attr("itemid"); ok {
+		item["@id"] = v
+	}
+	scope.Find(`[itemprop]`).Each(func(_ int, s *goquery.Selection) {
+		// 只处理直属于当前 itemscope 的属性
+		if !s.Parent().Closest(`[itemscope]`).IsSelection(scope) {
+			return
+		}
+		var value interface{}
+		if _, ok := s.Attr("itemscope"); ok {
+			value = parseMicrodataItem(s)
+		} else {
+			value = structuredPropValue(s, "content")
+		}
+		for _, name := range strings.Fields(s.AttrOr("itemprop", "")) {
+			addStructuredValue(item, name, value)
+		}
+	})
+	return item
+}
+
+// parseRDFa 解析 RDFa Lite (typeof/property)
+func parseRDFa(sel *goquery.Selection) []interface{} {
+	items := make([]interface{}, 0)
+	sel.Find(`[typeof]`).AddSelection(sel.Filter(`[typeof]`)).Each(func(_ int, s *goquery.Selection) {
+		if _, ok := s.Attr("property"); ok {
+			return
+		}
+		if s.Parent().Closest(`[typeof]`).Length() > 0 {
+			return
+		}
+		items = append(items, parseRDFaItem(s))
+	})
+	return items
+}
+
+func parseRDFaItem(scope *goquery.Selection) map[string]interface{} {
+	item := map[string]interface{}{}
+	if v := scope.AttrOr("typeof", ""); len(v) > 0 {
+		item["@type"] = trimRDFaPrefix(v)
+	}
+	if v, ok := scope.Attr("resource"); ok {
+		item["@id"] = v
+	}
+	scope.Find(`[property]`).Each(func(_ int, s *goquery.Selection) {
+		if !s.Parent().Closest(`[typeof]`).IsSelection(scope) {
+			return
+		}
+		var value interface{}
+		if _, ok := s.Attr("typeof"); ok {
+			value = parseRDFaItem(s)
+		} else {
+			value = structuredPropValue(s, "content", "resource")
+		}
+		for _, name := range strings.Fields(s.AttrOr("property", "")) {
+			addStructuredValue(item, trimRDFaPrefix(name), value)
+		}
+	})
+	return item
+}
+
+// trimRDFaPrefix schema:name => name
+func trimRDFaPrefix(name string) string {
+	if idx := strings.Index(name, ":"); idx >= 0 && !strings.Contains(name, "/") {
+		return name[idx+1:]
+	}
+	return name
+}
+
+// parseOpenGraph 解析 <meta property="og:*"> 等元数据。og: 前缀会被去掉，其它前缀(article:、twitter:等)保留
+func parseOpenGraph(sel *goquery.Selection) map[string]interface{} {
+	res := map[string]interface{}{}
+	sel.Find(`meta`).Each(func(_ int, s *goquery.Selection) {
+		name, ok := s.Attr("property")
+		if !ok {
+			name = s.AttrOr("name", "")
+		}
+		name = strings.TrimSpace(name)
+		content, ok := s.Attr("content")
+		if !ok || !strings.Contains(name, ":") {
+			return
+		}
+		prefix := name[:strings.Index(name, ":")]
+		switch prefix {
+		case "og":
+			name = strings.TrimPrefix(name, "og:")
+		case "article", "book", "profile", "music", "video", "product", "twitter", "fb":
+		default:
+			return
+		}
+		addStructuredValue(res, name, strings.TrimSpace(content))
+	})
+	return res
+}
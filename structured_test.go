@@ -0,0 +1,66 @@
+package gopiper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const structuredHTML = `<html><head>
+<meta property="og:title" content="Phone X">
+<meta property="og:type" content="product">
+<meta property="og:image" content="/a.jpg">
+<meta property="og:image" content="/b.jpg">
+<meta name="twitter:card" content="summary">
+<script type="application/ld+json">{"@context":"https://schema.org","@graph":[{"@type":"Organization","name":"ACME"},{"@type":"Product","name":"Phone X","offers":{"price":"99.00"}}]}</script>
+</head><body>
+<div itemscope itemtype="http://schema.org/Product">
+	<span itemprop="name">Phone X</span>
+	<div itemprop="offers" itemscope itemtype="http://schema.org/Offer">
+		<meta itemprop="price" content="99.00"><span itemprop="priceCurrency">USD</span>
+	</div>
+</div>
+<div vocab="https://schema.org/" typeof="Person"><span property="name">Alice</span><a property="url" href="/alice">home</a></div>
+</body></html>`
+
+func TestStructured(t *testing.T) {
+	body := []byte(structuredHTML)
+
+	pipe := PipeItem{Type: "jsonld[Product]", SubItem: []PipeItem{{Type: "string", Selector: "[0].offers.price"}}}
+	v, err := pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, "99.00", v)
+
+	pipe = PipeItem{Type: "jsonld"}
+	v, err = pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Len(t, v, 2)
+
+	pipe = PipeItem{Type: "microdata[Product]"}
+	v, err = pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"@type": "Product",
+		"name":  "Phone X",
+		"offers": map[string]interface{}{
+			"@type":         "Offer",
+			"price":         "99.00",
+			"priceCurrency": "USD",
+		},
+	}}, v)
+
+	pipe = PipeItem{Type: "rdfa"}
+	v, err = pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"@type": "Person", "name": "Alice", "url": "/alice"}}, v)
+
+	pipe = PipeItem{Type: "opengraph"}
+	v, err = pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"title":        "Phone X",
+		"type":         "product",
+		"image":        []interface{}{"/a.jpg", "/b.jpg"},
+		"twitter:card": "summary",
+	}, v)
+}
@@ -0,0 +1,205 @@
+package gopiper
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// table / table[N]: N为表头所在行的编号(从0开始)，-1代表没有表头(以列编号作为键)
+var tableExp = regexp.MustCompile(`^` + PT_TABLE + `(?:\[(-?\d+)\])?$`)
+
+// tableGrid 将 colspan/rowspan 展开后的表格
+type tableGrid struct {
+	rows      [][]string
+	headRows  int  // thead 中的行数
+	firstTh   bool // 第一行的单元格都是 th
+	maxColumn int
+}
+
+func newTableGrid(table *goquery.Selection) *tableGrid {
+	g := &tableGrid{}
+	trs := table.Find("tr").FilterFunction(func(_ int, tr *goquery.Selection) bool {
+		return tr.Closest("table").IsSelection(table) // 忽略嵌套的表格
+	})
+	g.headRows = trs.FilterFunction(func(_ int, tr *goquery.Selection) bool {
+		return tr.Parent().Is("thead")
+	}).Length()
+	pending := map[int]map[int]string{} // rowspan 占用的单元格: 行 => 列 => 值
+	trs.Each(func(r int, tr *goquery.Selection) {
+		row := []string{}
+		for c, v := range pending[r] {
+			for len(row) <= c {
+				row = append(row, "")
+			}
+			row[c] = v
+		}
+		filled := func(c int) bool {
+			_, ok := pending[r][c]
+			return ok
+		}
+		col := 0
+		cells := tr.ChildrenFiltered("th,td")
+		if r == 0 {
+			g.firstTh = cells.Length() > 0 && cells.Length() == cells.Filter("th").Length()
+		}
+		cells.Each(func(_ int, cell *goquery.Selection) {
+			for filled(col) {
+				col++
+			}
+			text := strings.Join(strings.Fields(cell.Text()), " ")
+			colspan := spanAttr(cell, "colspan")
+			rowspan := spanAttr(cell, "rowspan")
+			for i := 0; i < colspan; i++ {
+				for len(row) <= col+i {
+					row = append(row, "")
+				}
+				row[col+i] = text
+				for j := 1; j < rowspan; j++ {
+					if pending[r+j] == nil {
+						pending[r+j] = map[int]string{}
+					}
+					pending[r+j][col+i] = text
+				}
+			}
+			col += colspan
+		})
+		if len(row) > g.maxColumn {
+			g.maxColumn = len(row)
+		}
+		g.rows = append(g.rows, row)
+	})
+	return g
+}
+
+func spanAttr(cell *goquery.Selection, name string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(cell.AttrOr(name, "1")))
+	if err != nil || n < 1 {
+		return 1
+	}
+	if n > 1000 {
+		return 1000
+	}
+	return n
+}
+
+// headers 返回各列的名称以及数据行的起始位置
+func (g *tableGrid) headers(headerIndex int, auto bool) ([]string, int) {
+	var from, to int
+	switch {
+	case auto && g.headRows > 0:
+		from, to = 0, g.headRows
+	case auto && g.firstTh:
+		from, to = 0, 1
+	case auto, headerIndex < 0:
+		from, to = 0, 0
+	default:
+		from, to = headerIndex, headerIndex+1
+	}
+	if to > len(g.rows) {
+		to = len(g.rows)
+	}
+	keys := make([]string, g.maxColumn)
+	exists := map[string]int{}
+	for c := range keys {
+		var parts []string
+		for r := from; r < to; r++ {
+			if c >= len(g.rows[r]) || len(g.rows[r][c]) == 0 {
+				continue
+			}
+			text := g.rows[r][c]
+			if len(parts) > 0 && parts[len(parts)-1] == text {
+				continue
+			}
+			parts = append(parts, text)
+		}
+		key := strings.Join(parts, " ")
+		if len(key) == 0 {
+			key = strconv.Itoa(c)
+		}
+		exists[key]++
+		if n := exists[key]; n > 1 {
+			key += "_" + strconv.Itoa(n)
+		}
+		keys[c] = key
+	}
+	return keys, to
+}
+
+// pipeTable 将表格提取为以表头文本为键的map数组。
+// 有子规则时，子规则的 selector 为表头文本(或列编号)，name 为输出的键名，只输出子规则指定的列
+func (p *PipeItem) pipeTable(sel *goquery.Selection, params string) (interface{}, error) {
+	table := sel.First()
+	if !table.Is("table") {
+		table = sel.Find("table").First()
+	}
+	if table.Length() == 0 {
+		return nil, ErrTableNotFound
+	}
+	auto := len(params) == 0
+	headerIndex, _ := strconv.Atoi(params)
+	g := newTableGrid(table)
+	keys, start := g.headers(headerIndex, auto)
+	if err := p.checkArrayLength(len(g.rows) - start); err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for c, key := range keys {
+		columns[key] = c
+	}
+	subitems, err := orderSubItems(p.SubItem)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, 0, len(g.rows)-start)
+	for _, row := range g.rows[start:] {
+		if len(row) == 0 {
+			continue
+		}
+		item := map[string]interface{}{}
+		if len(p.SubItem) == 0 {
+			for c, key := range keys {
+				if c < len(row) {
+					item[key] = row[c]
+				} else {
+					item[key] = ""
+				}
+			}
+			res = append(res, item)
+			continue
+		}
+		for _, subitem := range subitems {
+			c, ok := columns[subitem.Selector]
+			if !ok {
+				var err error
+				c, err = strconv.Atoi(subitem.Selector)
+				if err != nil {
+					continue
+				}
+			}
+			var cell string
+			if c >= 0 && c < len(row) {
+				cell = row[c]
+			}
+			name := subitem.Name
+			if len(name) == 0 {
+				name = subitem.Selector
+			}
+			subitem.CopyFrom(p)
+			subitem.Selector = ``
+			subitem.scope = p.scope.child(item)
+			if len(subitem.Type) == 0 {
+				subitem.Type = PT_STRING
+			}
+			var err error
+			item[name], err = subitem.pipeText([]byte(cell))
+			if isAbort(err) {
+				return nil, err
+			}
+		}
+		res = append(res, item)
+	}
+	return callFilter(p, res, p.Filter)
+}
@@ -0,0 +1,72 @@
+package gopiper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable(t *testing.T) {
+	body := []byte(`<table id="t">
+	<thead>
+		<tr><th rowspan="2">名称</th><th colspan="2">价格</th></tr>
+		<tr><th>原价</th><th>现价</th></tr>
+	</thead>
+	<tbody>
+		<tr><td>A</td><td>10</td><td>8</td></tr>
+		<tr><td rowspan="2">B</td><td colspan="2">20</td></tr>
+		<tr><td>30</td><td>25</td></tr>
+	</tbody>
+</table>`)
+	pipe := PipeItem{Type: "table", Selector: "#t"}
+	v, err := pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"名称": "A", "价格 原价": "10", "价格 现价": "8"},
+		map[string]interface{}{"名称": "B", "价格 原价": "20", "价格 现价": "20"},
+		map[string]interface{}{"名称": "B", "价格 原价": "30", "价格 现价": "25"},
+	}, v)
+
+	pipe = PipeItem{
+		Type:     "table[1]",
+		Selector: "#t",
+		SubItem: []PipeItem{
+			{Name: "name", Selector: "0"},
+			{Name: "price", Selector: "现价", Type: "int"},
+		},
+	}
+	v, err = pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "A", "price": int64(8)},
+		map[string]interface{}{"name": "B", "price": int64(20)},
+		map[string]interface{}{"name": "B", "price": int64(25)},
+	}, v)
+
+	// 列可以引用同一行中的其它列
+	pipe.SubItem = []PipeItem{
+		{Name: "label", Selector: "原价", Filter: "preadd({$.name}:)"},
+		{Name: "name", Selector: "0"},
+	}
+	v, err = pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "A", "label": "A:10"},
+		map[string]interface{}{"name": "B", "label": "B:20"},
+		map[string]interface{}{"name": "B", "label": "B:30"},
+	}, v)
+
+	body = []byte(`<table><tr><th>名称</th><th>价格</th></tr><tr><td>A</td><td>10</td></tr></table>
+<table class="data"><tr><td>A</td><td>10</td></tr><tr><td>B</td><td>20</td></tr></table>`)
+	pipe = PipeItem{Type: "table", Selector: "table"}
+	v, err = pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"名称": "A", "价格": "10"}}, v)
+	pipe.Selector = ".data"
+	v, err = pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"0": "A", "1": "10"},
+		map[string]interface{}{"0": "B", "1": "20"},
+	}, v)
+}
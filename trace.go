@@ -0,0 +1,187 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// NewTrace 创建用于记录执行过程的跟踪树根节点
+func NewTrace() *TraceNode {
+	return &TraceNode{}
+}
+
+// TraceNode 规则项的一次执行记录
+type TraceNode struct {
+	Name     string        `json:"name,omitempty"`
+	Selector string        `json:"selector,omitempty"`
+	Type     string        `json:"type,omitempty"`
+	Filter   string        `json:"filter,omitempty"`
+	Steps    []*TraceStep  `json:"steps,omitempty"`    // 选择器各步骤匹配到的节点数
+	Value    interface{}   `json:"value,omitempty"`    // 过滤前提取到的原始值
+	Filters  []*TraceStep  `json:"filters,omitempty"`  // 各过滤器处理后的值
+	Warnings []string      `json:"warnings,omitempty"` // 不影响结果的错误，例如保存资源文件失败
+	Result   interface{}   `json:"result,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Children []*TraceNode  `json:"children,omitempty"`
+	start    time.Time
+}
+
+// TraceStep 选择器函数或过滤器的执行记录
+type TraceStep struct {
+	Name     string        `json:"name"`
+	Params   string        `json:"params,omitempty"`
+	Matched  *int          `json:"matched,omitempty"`
+	Value    interface{}   `json:"value,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+func (t *TraceNode) begin(p *PipeItem) *TraceNode {
+	if t == nil {
+		return nil
+	}
+	node := &TraceNode{
+		Name:     p.Name,
+		Selector: p.Selector,
+		Type:     p.Type,
+		Filter:   p.Filter,
+		start:    time.Now(),
+	}
+	t.Children = append(t.Children, node)
+	return node
+}
+
+func (t *TraceNode) end(result interface{}, err error) {
+	if t == nil {
+		return
+	}
+	t.Result = cloneValue(result)
+	if err != nil {
+		t.Error = err.Error()
+	}
+	t.Duration = time.Since(t.start)
+}
+
+func (t *TraceNode) addStep(name string, params string, matched int) {
+	if t == nil {
+		return
+	}
+	t.Steps = append(t.Steps, &TraceStep{Name: name, Params: params, Matched: &matched})
+}
+
+func (t *TraceNode) setValue(value interface{}) {
+	if t == nil {
+		return
+	}
+	t.Value = cloneValue(value)
+}
+
+func (t *TraceNode) addFilter(name string, params string, value interface{}, err error, d time.Duration) {
+	if t == nil {
+		return
+	}
+	step := &TraceStep{Name: name, Params: params, Value: cloneValue(value), Duration: d}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	t.Filters = append(t.Filters, step)
+}
+
+func (t *TraceNode) addWarning(err error) {
+	if t == nil {
+		return
+	}
+	t.Warnings = append(t.Warnings, err.Error())
+}
+
+// JSON 序列化为JSON
+func (t *TraceNode) JSON() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+// Print 以缩进树的形式输出
+func (t *TraceNode) Print(w io.Writer) {
+	t.print(w, 0)
+}
+
+func (t *TraceNode) String() string {
+	b := &strings.Builder{}
+	t.Print(b)
+	return b.String()
+}
+
+func (t *TraceNode) print(w io.Writer, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if len(t.Type) > 0 || len(t.Selector) > 0 {
+		fmt.Fprintf(w, "%s- [%s] %s selector=%q (%v)\n", indent, t.Type, t.Name, t.Selector, t.Duration)
+		for _, s := range t.Steps {
+			fmt.Fprintf(w, "%s    | %s(%s) => %d nodes\n", indent, s.Name, s.Params, *s.Matched)
+		}
+		if t.Value != nil {
+			fmt.Fprintf(w, "%s    value: %s\n", indent, traceValueString(t.Value))
+		}
+		for _, f := range t.Filters {
+			if len(f.Error) > 0 {
+				fmt.Fprintf(w, "%s    > %s(%s) error: %s (%v)\n", indent, f.Name, f.Params, f.Error, f.Duration)
+				continue
+			}
+			fmt.Fprintf(w, "%s    > %s(%s) => %s (%v)\n", indent, f.Name, f.Params, traceValueString(f.Value), f.Duration)
+		}
+		for _, warning := range t.Warnings {
+			fmt.Fprintf(w, "%s    warning: %s\n", indent, warning)
+		}
+		if len(t.Error) > 0 {
+			fmt.Fprintf(w, "%s    error: %s\n", indent, t.Error)
+		}
+		depth++
+	}
+	for _, c := range t.Children {
+		c.print(w, depth)
+	}
+}
+
+func traceValueString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// cloneValue 复制切片和map(过滤器会就地修改它们)
+func cloneValue(src interface{}) interface{} {
+	switch vt := src.(type) {
+	case []string:
+		return append([]string{}, vt...)
+	case []int64:
+		return append([]int64{}, vt...)
+	case []float64:
+		return append([]float64{}, vt...)
+	case []bool:
+		return append([]bool{}, vt...)
+	case map[string]string:
+		r := make(map[string]string, len(vt))
+		for k, v := range vt {
+			r[k] = v
+		}
+		return r
+	case []interface{}:
+		r := make([]interface{}, len(vt))
+		for k, v := range vt {
+			r[k] = cloneValue(v)
+		}
+		return r
+	case map[string]interface{}:
+		r := make(map[string]interface{}, len(vt))
+		for k, v := range vt {
+			r[k] = cloneValue(v)
+		}
+		return r
+	default:
+		return src
+	}
+}
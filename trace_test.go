@@ -0,0 +1,67 @@
+package gopiper
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrace(t *testing.T) {
+	body := []byte(`<ul><li><a href="/a">A</a></li><li><a href="/b"> B </a></li></ul>`)
+	pipe := PipeItem{}
+	err := json.Unmarshal([]byte(`{
+		"type": "array",
+		"selector": "ul li|eq(1)",
+		"subitem": [
+			{
+				"type": "map",
+				"subitem": [
+					{"name": "title", "type": "text", "selector": "a", "filter": "trimspace|preadd(#)"}
+				]
+			}
+		]
+	}`), &pipe)
+	assert.NoError(t, err)
+	trace := NewTrace()
+	pipe.SetTrace(trace)
+	v, err := pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"title": "#B"}}, v)
+
+	assert.Len(t, trace.Children, 1)
+	root := trace.Children[0]
+	assert.Len(t, root.Steps, 2)
+	assert.Equal(t, 2, *root.Steps[0].Matched)
+	assert.Equal(t, "eq", root.Steps[1].Name)
+	assert.Equal(t, 1, *root.Steps[1].Matched)
+
+	title := root.Children[0].Children[0]
+	assert.Equal(t, "title", title.Name)
+	assert.Equal(t, " B ", title.Value)
+	assert.Len(t, title.Filters, 2)
+	assert.Equal(t, "B", title.Filters[0].Value)
+	assert.Equal(t, "#B", title.Filters[1].Value)
+
+	_, err = trace.JSON()
+	assert.NoError(t, err)
+	assert.Contains(t, trace.String(), `> preadd(#) => "#B"`)
+
+	// 没有过滤器时也记录提取到的值
+	pipe = PipeItem{Type: "text", Selector: "li a"}
+	trace = NewTrace()
+	pipe.SetTrace(trace)
+	_, err = pipe.PipeBytes(body, "html")
+	assert.NoError(t, err)
+	assert.Equal(t, "A B ", trace.Children[0].Value)
+
+	// 文本的 map 子规则记录在 map 节点下
+	pipe = PipeItem{Type: "map", SubItem: []PipeItem{{Name: "id", Type: "text", Selector: `regexp:id=(\d+)`}}}
+	trace = NewTrace()
+	pipe.SetTrace(trace)
+	_, err = pipe.PipeBytes([]byte(`id=42`), "text")
+	assert.NoError(t, err)
+	if assert.Len(t, trace.Children, 1) && assert.Len(t, trace.Children[0].Children, 1) {
+		assert.Equal(t, "42", trace.Children[0].Children[0].Result)
+	}
+}
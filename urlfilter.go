@@ -0,0 +1,253 @@
+package gopiper
+
+import (
+	"errors"
+	"net"
+	neturl "net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// defaultPorts urlnormalize 会删除的默认端口
+var defaultPorts = map[string]string{
+	`http`:  `80`,
+	`https`: `443`,
+	`ftp`:   `21`,
+	`ws`:    `80`,
+	`wss`:   `443`,
+}
+
+// _filterURL 解析网址后执行fn。数组和map中的每个网址与 _filterValue 的处理方式相同，
+// fn 的结果不是字符串时(例如 urlparse)，[]string 和 map[string]string 分别转为 []interface{} 和 map[string]interface{}
+func _filterURL(src interface{}, fn func(u *neturl.URL) (interface{}, error)) (interface{}, error) {
+	parse := func(s string) (interface{}, error) {
+		u, err := neturl.Parse(strings.TrimSpace(s))
+		if err != nil {
+			return s, err
+		}
+		return fn(u)
+	}
+	switch vt := src.(type) {
+	case []string:
+		res := make([]interface{}, len(vt))
+		allString := true
+		for i, v := range vt {
+			res[i] = urlResult(parse(v))
+			_, ok := res[i].(string)
+			allString = allString && ok
+		}
+		if !allString {
+			return res, nil
+		}
+		for i, v := range res {
+			vt[i] = v.(string)
+		}
+		return vt, nil
+	case map[string]string:
+		res := make(map[string]interface{}, len(vt))
+		allString := true
+		for k, v := range vt {
+			res[k] = urlResult(parse(v))
+			_, ok := res[k].(string)
+			allString = allString && ok
+		}
+		if !allString {
+			return res, nil
+		}
+		for k, v := range res {
+			vt[k] = v.(string)
+		}
+		return vt, nil
+	}
+	return _filterValue(src, parse, func(v interface{}) (interface{}, error) {
+		return v, nil // 数字等不是网址
+	})
+}
+
+// urlResult 数组或map中的网址解析失败时替换为错误信息
+func urlResult(v interface{}, err error) interface{} {
+	if err != nil {
+		return err.Error()
+	}
+	return v
+}
+
+// queryPair 查询字符串中的参数(保留原来的顺序和编码)
+type queryPair struct {
+	key string // 已解码的参数名
+	raw string // 原始的“名=值”
+}
+
+func splitQuery(rawQuery string) []queryPair {
+	var pairs []queryPair
+	for _, raw := range strings.Split(rawQuery, `&`) {
+		if len(raw) == 0 {
+			continue
+		}
+		key := raw
+		if pos := strings.Index(key, `=`); pos >= 0 {
+			key = key[:pos]
+		}
+		if k, err := neturl.QueryUnescape(key); err == nil {
+			key = k
+		}
+		pairs = append(pairs, queryPair{key: key, raw: raw})
+	}
+	return pairs
+}
+
+func joinQuery(pairs []queryPair) string {
+	raws := make([]string, len(pairs))
+	for i, pair := range pairs {
+		raws[i] = pair.raw
+	}
+	return strings.Join(raws, `&`)
+}
+
+// urlparse => src="https://a.com:8080/p?x=1#f" => {"scheme":"https","host":"a.com:8080","hostname":"a.com","port":"8080","path":"/p","query":{"x":"1"},"rawquery":"x=1","fragment":"f"}
+// 参数出现多次时 query 中的值为数组
+func urlparse(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterURL(src, func(u *neturl.URL) (interface{}, error) {
+		query := map[string]interface{}{}
+		for k, v := range u.Query() {
+			if len(v) == 1 {
+				query[k] = v[0]
+				continue
+			}
+			query[k] = v
+		}
+		return map[string]interface{}{
+			`scheme`:   u.Scheme,
+			`host`:     u.Host,
+			`hostname`: u.Hostname(),
+			`port`:     u.Port(),
+			`path`:     u.Path,
+			`query`:    query,
+			`rawquery`: u.RawQuery,
+			`fragment`: u.Fragment,
+		}, nil
+	})
+}
+
+// queryget(id) => src="https://a.com/?id=1" => "1"
+func queryget(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	name := strings.TrimSpace(params)
+	if len(name) == 0 {
+		return src, errors.New("Filter queryget need param name")
+	}
+	return _filterURL(src, func(u *neturl.URL) (interface{}, error) {
+		return u.Query().Get(name), nil
+	})
+}
+
+// queryset(page,2) => src="https://a.com/?id=1&page=1" => "https://a.com/?id=1&page=2"
+func queryset(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	args := strings.SplitN(params, `,`, 2)
+	name := strings.TrimSpace(args[0])
+	if len(args) != 2 || len(name) == 0 {
+		return src, errors.New("Filter queryset need two params")
+	}
+	raw := neturl.QueryEscape(name) + `=` + neturl.QueryEscape(args[1])
+	return _filterURL(src, func(u *neturl.URL) (interface{}, error) {
+		var pairs []queryPair
+		found := false
+		for _, pair := range splitQuery(u.RawQuery) {
+			if pair.key != name {
+				pairs = append(pairs, pair)
+				continue
+			}
+			if !found { // 替换第一个同名参数，删除其余的
+				pairs = append(pairs, queryPair{key: name, raw: raw})
+				found = true
+			}
+		}
+		if !found {
+			pairs = append(pairs, queryPair{key: name, raw: raw})
+		}
+		u.RawQuery = joinQuery(pairs)
+		return u.String(), nil
+	})
+}
+
+// querydel(utm_*,fbclid) => src="https://a.com/?id=1&utm_source=x&fbclid=y" => "https://a.com/?id=1"
+// 参数名支持通配符(*、?)
+func querydel(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	patterns := SplitParams(params)
+	for i, pattern := range patterns {
+		patterns[i] = strings.TrimSpace(pattern)
+		if _, err := path.Match(patterns[i], ``); err != nil {
+			return src, err
+		}
+	}
+	return _filterURL(src, func(u *neturl.URL) (interface{}, error) {
+		var pairs []queryPair
+	NEXT:
+		for _, pair := range splitQuery(u.RawQuery) {
+			for _, pattern := range patterns {
+				if matched, _ := path.Match(pattern, pair.key); matched {
+					continue NEXT
+				}
+			}
+			pairs = append(pairs, pair)
+		}
+		u.RawQuery = joinQuery(pairs)
+		u.ForceQuery = false
+		return u.String(), nil
+	})
+}
+
+// NormalizeURL 规范化网址：协议和域名转为小写，删除默认端口、片段(#)和路径中的“.”和“..”，按参数名排序查询参数，路径为空时设为“/”
+func NormalizeURL(u *neturl.URL) string {
+	u.Scheme = strings.ToLower(u.Scheme)
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ``
+	}
+	// 没有端口时删除末尾的“:”(IPv6 地址保留方括号)
+	u.Host = strings.TrimSuffix(net.JoinHostPort(strings.ToLower(u.Hostname()), port), `:`)
+	u.Fragment = ``
+	u.RawFragment = ``
+	if len(u.Path) > 0 {
+		// 按转义后的路径整理，保留 %2F 等编码的字符
+		escaped := u.EscapedPath()
+		cleaned := path.Clean(escaped)
+		if strings.HasSuffix(escaped, `/`) && cleaned != `/` {
+			cleaned += `/`
+		}
+		if unescaped, err := neturl.PathUnescape(cleaned); err == nil {
+			u.Path = unescaped
+			u.RawPath = cleaned
+		}
+	} else if len(u.Host) > 0 {
+		u.Path = `/`
+	}
+	pairs := splitQuery(u.RawQuery)
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].key < pairs[j].key
+	})
+	u.RawQuery = joinQuery(pairs)
+	u.ForceQuery = false
+	return u.String()
+}
+
+// urlnormalize => src="HTTP://A.com:80/a/../b/?z=1&a=2#top" => "http://a.com/b/?a=2&z=1"
+func urlnormalize(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	return _filterURL(src, func(u *neturl.URL) (interface{}, error) {
+		return NormalizeURL(u), nil
+	})
+}
+
+// urljoin(https://a.com/news/) => src="../img/1.jpg" => "https://a.com/img/1.jpg"
+func urljoin(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
+	base, err := neturl.Parse(strings.TrimSpace(params))
+	if err != nil {
+		return src, err
+	}
+	if !base.IsAbs() {
+		return src, errors.New("Filter urljoin need absolute base url")
+	}
+	return _filterURL(src, func(u *neturl.URL) (interface{}, error) {
+		return base.ResolveReference(u).String(), nil
+	})
+}
@@ -6,7 +6,6 @@ import (
 	"strconv"
 	"unicode/utf8"
 
-	"github.com/admpub/regexp2"
 	"github.com/webx-top/com"
 )
 
@@ -255,12 +254,16 @@ func unmatch(pipe *PipeItem, src interface{}, params string) (interface{}, error
 }
 
 func match2(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
-	re, err := regexp2.Compile(params, regexp2.RE2)
+	re, err := pipe.compileRegexp2(params)
 	if err != nil {
 		return src, fmt.Errorf(`invalid regexp2 params: _match2(%s): %w`, params, err)
 	}
 	return _filterValue(src, func(v string) (interface{}, error) {
-		if ok, _ := re.MatchString(v); !ok {
+		ok, err := re.MatchString(v)
+		if err != nil {
+			return v, regexp2Error(re, err)
+		}
+		if !ok {
 			return v, ErrInvalidContent
 		}
 		return v, nil
@@ -268,12 +271,16 @@ func match2(pipe *PipeItem, src interface{}, params string) (interface{}, error)
 }
 
 func unmatch2(pipe *PipeItem, src interface{}, params string) (interface{}, error) {
-	re, err := regexp2.Compile(params, regexp2.RE2)
+	re, err := pipe.compileRegexp2(params)
 	if err != nil {
 		return src, fmt.Errorf(`invalid regexp2 params: _unmatch2(%s): %w`, params, err)
 	}
 	return _filterValue(src, func(v string) (interface{}, error) {
-		if ok, _ := re.MatchString(v); ok {
+		ok, err := re.MatchString(v)
+		if err != nil {
+			return v, regexp2Error(re, err)
+		}
+		if ok {
 			return v, ErrInvalidContent
 		}
 		return v, nil